@@ -0,0 +1,133 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// condaEnvironment is the part of a Conda environment.yml we check
+type condaEnvironment struct {
+	Name         string        `json:"name,omitempty"`
+	Channels     []string      `json:"channels,omitempty"`
+	Dependencies []interface{} `json:"dependencies"`
+}
+
+// validateCondaEnvironmentFile checks that the content is a Conda environment.yml listing dependencies
+func validateCondaEnvironmentFile(content string) error {
+	environment := condaEnvironment{}
+	if err := yaml.Unmarshal([]byte(content), &environment); err != nil {
+		return fmt.Errorf("not a Conda environment file: %w", err)
+	}
+
+	if len(environment.Dependencies) == 0 {
+		return fmt.Errorf("the Conda environment has no dependencies")
+	}
+
+	for _, dependency := range environment.Dependencies {
+		switch d := dependency.(type) {
+		case string:
+			if strings.TrimSpace(d) == "" {
+				return fmt.Errorf("the Conda environment has an empty dependency")
+			}
+		case map[string]interface{}:
+			// the only nested dependencies are the ones installed by pip
+			if _, ok := d["pip"]; !ok || len(d) != 1 {
+				return fmt.Errorf("the Conda environment has an unsupported dependency %v", d)
+			}
+		default:
+			return fmt.Errorf("the Conda environment has an unsupported dependency %v", d)
+		}
+	}
+
+	return nil
+}
+
+// validatePipfile checks that the content looks like a Pipfile, which requires a [packages] table.
+// The TOML itself is parsed by pipenv during the build.
+func validatePipfile(content string) error {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "[packages]" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the Pipfile has no [packages] table")
+}
+
+// pipfileLock is the part of a Pipfile.lock we check
+type pipfileLock struct {
+	Meta    *json.RawMessage           `json:"_meta"`
+	Default map[string]json.RawMessage `json:"default"`
+}
+
+// validatePipfileLock checks that the content is a Pipfile.lock
+func validatePipfileLock(content string) error {
+	lock := pipfileLock{}
+	if err := json.Unmarshal([]byte(content), &lock); err != nil {
+		return fmt.Errorf("not a Pipfile.lock: %w", err)
+	}
+
+	if lock.Meta == nil {
+		return fmt.Errorf("the Pipfile.lock has no _meta section")
+	}
+
+	return nil
+}
+
+// validateContainerfile checks that the content is a Containerfile, its first instruction has to be a FROM,
+// which may only be preceded by ARG instructions
+func validateContainerfile(content string) error {
+	continued := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// lines continuing an instruction are not instructions themselves
+		wasContinued := continued
+		continued = strings.HasSuffix(line, "\\")
+		if wasContinued {
+			continue
+		}
+
+		switch instruction := strings.ToUpper(strings.Fields(line)[0]); instruction {
+		case "FROM":
+			return nil
+		case "ARG":
+			continue
+		default:
+			return fmt.Errorf("the Containerfile has to start with a FROM instruction, not %s", instruction)
+		}
+	}
+
+	return fmt.Errorf("the Containerfile has no FROM instruction")
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+)
+
+// TestValidateBuildFiles tests the checks of the files used by the CondaEnvironment, Pipenv and Containerfile build types
+func TestValidateBuildFiles(t *testing.T) {
+	testCases := map[string]struct {
+		validate      func(string) error
+		input         string
+		expectedValid bool
+	}{
+		"conda-environment": {
+			validate:      validateCondaEnvironmentFile,
+			input:         "name: base\nchannels:\n  - conda-forge\ndependencies:\n  - python=3.8\n  - pandas\n  - pip:\n      - boto3>=1.24.0\n",
+			expectedValid: true,
+		},
+		"conda-environment-no-dependencies": {
+			validate: validateCondaEnvironmentFile,
+			input:    "name: base\nchannels:\n  - conda-forge\n",
+		},
+		"conda-environment-unsupported-dependency": {
+			validate: validateCondaEnvironmentFile,
+			input:    "dependencies:\n  - pandas\n  - npm:\n      - left-pad\n",
+		},
+		"conda-environment-not-yaml": {
+			validate: validateCondaEnvironmentFile,
+			input:    "dependencies: [pandas",
+		},
+		"pipfile": {
+			validate:      validatePipfile,
+			input:         "[[source]]\nurl = \"https://pypi.org/simple\"\nverify_ssl = true\nname = \"pypi\"\n\n[packages] # runtime\npandas = \"*\"\n\n[requires]\npython_version = \"3.8\"\n",
+			expectedValid: true,
+		},
+		"pipfile-no-packages": {
+			validate: validatePipfile,
+			input:    "[dev-packages]\npytest = \"*\"\n# [packages]\n",
+		},
+		"pipfile-lock": {
+			validate:      validatePipfileLock,
+			input:         `{"_meta": {"hash": {"sha256": "abc"}, "pipfile-spec": 6}, "default": {"pandas": {"version": "==1.4.3"}}, "develop": {}}`,
+			expectedValid: true,
+		},
+		"pipfile-lock-no-meta": {
+			validate: validatePipfileLock,
+			input:    `{"default": {"pandas": {"version": "==1.4.3"}}}`,
+		},
+		"pipfile-lock-not-json": {
+			validate: validatePipfileLock,
+			input:    "[packages]\npandas = \"*\"\n",
+		},
+		"containerfile": {
+			validate:      validateContainerfile,
+			input:         "# syntax=docker/dockerfile:1\nARG BASE=quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2\nFROM $BASE\nRUN dnf install -y graphviz\n",
+			expectedValid: true,
+		},
+		"containerfile-instruction-before-from": {
+			validate: validateContainerfile,
+			input:    "RUN dnf install -y graphviz\nFROM quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2\n",
+		},
+		"containerfile-from-in-continuation": {
+			validate: validateContainerfile,
+			input:    "ARG PACKAGES=graphviz \\\n  FROM\n",
+		},
+		"containerfile-empty": {
+			validate: validateContainerfile,
+			input:    "# nothing to build\n",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		err := tc.validate(tc.input)
+		if tc.expectedValid && err != nil {
+			t.Errorf("%s Got error %s while expecting none", tcName, err)
+		}
+		if !tc.expectedValid && err == nil {
+			t.Errorf("%s Got no error while expecting one", tcName)
+		}
+	}
+}
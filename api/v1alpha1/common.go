@@ -17,14 +17,16 @@ limitations under the License.
 package v1alpha1
 
 // Phase describes the phase of the CustomRuntimeEnvironment
-// +kubebuilder:validation:Enum=Pending;Failed;Running;Succeeded;Unknown
+// +kubebuilder:validation:Enum=Pending;Queued;Failed;Running;Succeeded;Cancelled;Unknown
 type Phase string
 
 const (
 	PhasePending   = Phase("Pending")
+	PhaseQueued    = Phase("Queued")
 	PhaseFailed    = Phase("Failed")
 	PhaseRunning   = Phase("Running")
 	PhaseBuilding  = Phase("Building")
 	PhaseSucceeded = Phase("Succeeded")
+	PhaseCancelled = Phase("Cancelled")
 	PhaseUnknown   = Phase("Unknown")
 )
@@ -25,12 +25,42 @@ const (
 	// ErrorPipelineRunCreate indicates that the Tekton pipeline run creation failed
 	ErrorPipelineRunCreate = "ErrorPipelineRunCreate"
 
+	// ErrorResolvingBaseImage indicates that no RuntimeEnvironmentCatalog provides a base image for the runtime environment
+	ErrorResolvingBaseImage = "ErrorResolvingBaseImage"
+
+	// ErrorEvaluatingParamTemplate indicates that a parameter template of the operator config, customizing the
+	// parameters of the pipeline, could not be evaluated for the CustomRuntimeEnvironment
+	ErrorEvaluatingParamTemplate = "ErrorEvaluatingParamTemplate"
+
+	// BuildBackendUnavailable indicates that the build backend selected for the CustomRuntimeEnvironment is not
+	// available in the cluster
+	BuildBackendUnavailable = "BuildBackendUnavailable"
+
+	// CacheHit indicates that the image of a build from the same inputs has been reused instead of building it again
+	CacheHit = "CacheHit"
+
+	// BuildQueued indicates that the build waits for other builds to finish, as the concurrency limits of the
+	// operator are reached
+	BuildQueued = "BuildQueued"
+
+	// BuildCancelled indicates that the build was cancelled on request, by the cancel annotation
+	BuildCancelled = "BuildCancelled"
+
+	// BuildTimedOut indicates that the build was cancelled because it ran longer than its build timeout, or was
+	// pending longer than the operator allows
+	BuildTimedOut = "BuildTimedOut"
+
 	// ImportingImage indicates that the image is being imported from a remote registry
 	ImportingImage = "ImportingImage"
 
-	// RequredSecretMissing indicates that the secret required for authentication to the container image registry is missing
+	// RequredSecretMissing indicates that the secret required for authentication to the container image registry
+	// or the git repository is missing
 	RequiredSecretMissing = "RequiredSecretMissing"
 
+	// BuildFileUnavailable indicates that a file used for building, e.g. the Pipfile, can not be read from the
+	// ConfigMap it references
+	BuildFileUnavailable = "BuildFileUnavailable"
+
 	// ValidatingImportedImage indicates that the imported image is being validated by a Tekton PipelineRun's Step
 	ValidatingImportedImage = "ValidatingImportedImage"
 
@@ -49,6 +79,18 @@ const (
 	// PackageListBuildCompleted indicates that the package list build completed
 	PackageListBuildCompleted = "PackageListBuildCompleted"
 
+	// GitRepositoryBuildCompleted indicates that the git repository build completed
+	GitRepositoryBuildCompleted = "GitRepositoryBuildCompleted"
+
+	// CondaEnvironmentBuildCompleted indicates that the Conda environment build completed
+	CondaEnvironmentBuildCompleted = "CondaEnvironmentBuildCompleted"
+
+	// PipenvBuildCompleted indicates that the Pipenv build completed
+	PipenvBuildCompleted = "PipenvBuildCompleted"
+
+	// ContainerfileBuildCompleted indicates that the Containerfile build completed
+	ContainerfileBuildCompleted = "ContainerfileBuildCompleted"
+
 	// ErrorBuildingImage indicates that the image build failed
 	ErrorBuildingImage = "ErrorBuildingImage"
 
@@ -57,4 +99,94 @@ const (
 
 	// PipelineRunCompleted indicates that the Tekton pipeline run completed
 	PipelineRunCompleted = "PipelineRunCompleted"
+
+	// CleaningUp indicates that the ImageStreams and workspaces produced by the builds are being deleted
+	CleaningUp = "CleaningUp"
+
+	// ErrorCleaningUp indicates that the deletion of the ImageStreams or workspaces produced by the builds failed
+	ErrorCleaningUp = "ErrorCleaningUp"
 )
+
+// buildScopedConditions are the condition types describing the build of the current generation, they are reset when
+// another build starts. The conditions describing the CustomRuntimeEnvironment itself, e.g. RequiredSecretMissing,
+// BuildFileUnavailable, BuildBackendUnavailable or CleaningUp, are kept.
+var buildScopedConditions = []string{
+	PipelineRunCreated,
+	ErrorPipelineRunCreate,
+	BuildQueued,
+	BuildCancelled,
+	BuildTimedOut,
+	ImportingImage,
+	ValidatingImportedImage,
+	ImageImportReady,
+	ImageImportInvalid,
+	ErrorResolvingDependencies,
+	BuildingImage,
+	PackageListBuildCompleted,
+	GitRepositoryBuildCompleted,
+	CondaEnvironmentBuildCompleted,
+	PipenvBuildCompleted,
+	ContainerfileBuildCompleted,
+	ErrorBuildingImage,
+	GenericPipelineError,
+	PipelineRunCompleted,
+}
+
+// BuildCondition describes the condition reporting the outcome of the builds of a build type,
+// it is True once a build succeeded and False once it failed
+type BuildCondition struct {
+	// Type of the condition
+	Type string
+	// SucceededReason and SucceededMessage are reported once a build succeeded
+	SucceededReason  string
+	SucceededMessage string
+	// FailedReason and FailedMessage are reported once a build failed
+	FailedReason  string
+	FailedMessage string
+}
+
+// BuildConditions maps each build type to the condition reporting the outcome of its builds
+var BuildConditions = map[BuildType]BuildCondition{
+	ImportImage: {
+		Type:             ImageImportReady,
+		SucceededReason:  "ImageImportReady",
+		SucceededMessage: "Import succeeded, the image is ready to be used.",
+		FailedReason:     "ImageImportNotReady",
+		FailedMessage:    "Import failed, this could be due to the repository to import from does not exist or is not accessible",
+	},
+	PackageList: {
+		Type:             PackageListBuildCompleted,
+		SucceededReason:  "PackageListBuildCompleted",
+		SucceededMessage: "Build from Package List succeeded, the image is ready to be used.",
+		FailedReason:     "PackageListBuildCompleted",
+		FailedMessage:    "Build from Package List failed!",
+	},
+	GitRepository: {
+		Type:             GitRepositoryBuildCompleted,
+		SucceededReason:  "GitRepositoryBuildCompleted",
+		SucceededMessage: "Build from git repository succeeded, the image is ready to be used.",
+		FailedReason:     "GitRepositoryBuildCompleted",
+		FailedMessage:    "Build from git repository failed!",
+	},
+	CondaEnvironment: {
+		Type:             CondaEnvironmentBuildCompleted,
+		SucceededReason:  "CondaEnvironmentBuildCompleted",
+		SucceededMessage: "Build from Conda environment succeeded, the image is ready to be used.",
+		FailedReason:     "CondaEnvironmentBuildCompleted",
+		FailedMessage:    "Build from Conda environment failed!",
+	},
+	Pipenv: {
+		Type:             PipenvBuildCompleted,
+		SucceededReason:  "PipenvBuildCompleted",
+		SucceededMessage: "Build from Pipfile succeeded, the image is ready to be used.",
+		FailedReason:     "PipenvBuildCompleted",
+		FailedMessage:    "Build from Pipfile failed!",
+	},
+	Containerfile: {
+		Type:             ContainerfileBuildCompleted,
+		SucceededReason:  "ContainerfileBuildCompleted",
+		SucceededMessage: "Build from Containerfile succeeded, the image is ready to be used.",
+		FailedReason:     "ContainerfileBuildCompleted",
+		FailedMessage:    "Build from Containerfile failed!",
+	},
+}
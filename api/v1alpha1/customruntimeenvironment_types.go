@@ -19,13 +19,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // BuildType describes how to build a custom notebook image.
 // Only one of the following build types may be specified.
 // +kubebuilder:validation:MinLength:1
-// +kubebuilder:validation:Enum=ImageImport;PackageList;GitRepository
+// +kubebuilder:validation:Enum=ImageImport;PackageList;GitRepository;CondaEnvironment;Pipenv;Containerfile
 type BuildType string
 
 const (
@@ -38,6 +44,60 @@ const (
 
 	// BuildGitRepository will builds a custom image from a git repository
 	GitRepository BuildType = "GitRepository"
+
+	// CondaEnvironment will build a custom image from a Conda environment.yml, the base image has to provide conda
+	// if no RuntimeEnvironment is specified, a baseImage must be specified for the build
+	CondaEnvironment BuildType = "CondaEnvironment"
+
+	// Pipenv will build a custom image from a Pipfile, installing the versions pinned by its Pipfile.lock if given
+	// if no RuntimeEnvironment is specified, a baseImage must be specified for the build
+	Pipenv BuildType = "Pipenv"
+
+	// Containerfile will build a custom image from a Containerfile, either found in a git repository or given
+	// in the Custom Runtime Environment, for dependencies which cannot be installed as Python packages
+	Containerfile BuildType = "Containerfile"
+)
+
+// BuildsOnBaseImage returns true if the build type installs packages on top of a baseImage or
+// of the base image resolved for the RuntimeEnvironment
+func (b BuildType) BuildsOnBaseImage() bool {
+	return b == PackageList || b == CondaEnvironment || b == Pipenv
+}
+
+// LockMode describes whether a rebuild resolves the packages again or reuses the pinned requirements of a previous build.
+// +kubebuilder:validation:Enum=Unlocked;Locked
+type LockMode string
+
+const (
+	// Unlocked will resolve the package versions again on every build
+	Unlocked LockMode = "Unlocked"
+
+	// Locked will reuse the pinned requirements of the last successful build, as long as the package versions are unchanged
+	Locked LockMode = "Locked"
+)
+
+// RetainPolicy describes what happens to the images built for a Custom Runtime Environment when it is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain
+type RetainPolicy string
+
+const (
+	// RetainPolicyDelete will delete the ImageStreams and workspaces produced by the builds
+	RetainPolicyDelete RetainPolicy = "Delete"
+
+	// RetainPolicyRetain will keep the ImageStreams and workspaces produced by the builds
+	RetainPolicyRetain RetainPolicy = "Retain"
+)
+
+// BuildBackend describes what runs the builds of a Custom Runtime Environment.
+// +kubebuilder:validation:Enum=Tekton;Job
+type BuildBackend string
+
+const (
+	// TektonBuildBackend runs the builds as Tekton PipelineRuns
+	TektonBuildBackend BuildBackend = "Tekton"
+
+	// JobBuildBackend runs the builds as Kubernetes Jobs, for clusters without Tekton
+	JobBuildBackend BuildBackend = "Job"
 )
 
 // CRE Annotations is a list of annotations that are added to the custom notebook image
@@ -45,14 +105,91 @@ const (
 	CRENameAnnotationKey        = "opendatahub.io/notebook-image-name"
 	CREDescriptionAnnotationKey = "opendatahub.io/notebook-image-desc"
 	CRECreatorAnnotationKey     = "opendatahub.io/notebook-image-creator"
+
+	// CREForceRebuildAnnotationKey allows changing the spec while a build is running, the running build is
+	// cancelled. The annotation has to be set along with the spec change, it is removed once the controller has
+	// seen it, whether the spec changed or not.
+	CREForceRebuildAnnotationKey = "meteor.zone/force-rebuild"
+
+	// CREForceDeleteAnnotationKey allows deleting the Custom Runtime Environment while its image is still in use
+	CREForceDeleteAnnotationKey = "meteor.zone/force-delete"
+
+	// CRECancelAnnotationKey cancels the running build of the Custom Runtime Environment, the operator removes it
+	// once the build is cancelled
+	CRECancelAnnotationKey = "meteor.zone/cancel"
+
+	// CRERetryAnnotationKey builds the current generation of the Custom Runtime Environment again once its build
+	// has finished, the operator removes it once the new build is created
+	CRERetryAnnotationKey = "meteor.zone/retry"
 )
 
+// DefaultBuildHistoryLimit is the number of previous generations' builds kept if BuildHistoryLimit is not set
+const DefaultBuildHistoryLimit = 3
+
+// DefaultGitRef is the git reference used if GitRef is not set, it refers to the default branch of the Repository
+const DefaultGitRef = "HEAD"
+
+// DefaultContainerfilePath is the path of the Containerfile within the ContextDir used if ContainerfilePath is not set
+const DefaultContainerfilePath = "Containerfile"
+
 // ImagePullSecret is a secret that is used to pull images from a private registry
 type ImagePullSecret struct {
 	// Name of the secret to be used
 	Name string `json:"name"`
 }
 
+// GitSecret is a secret that is used to clone a private git repository, either of type kubernetes.io/ssh-auth
+// or kubernetes.io/basic-auth
+type GitSecret struct {
+	// Name of the secret to be used
+	Name string `json:"name"`
+}
+
+// GitSecretTypes are the types of secret a GitSecret may refer to
+var GitSecretTypes = []corev1.SecretType{corev1.SecretTypeSSHAuth, corev1.SecretTypeBasicAuth}
+
+// IsGitSecretType returns true if a GitSecret may refer to a secret of the type
+func IsGitSecretType(secretType corev1.SecretType) bool {
+	for _, gitSecretType := range GitSecretTypes {
+		if secretType == gitSecretType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConfigMapKeyReference refers to a key of a ConfigMap in the namespace of the Custom Runtime Environment
+type ConfigMapKeyReference struct {
+	// Name of the ConfigMap
+	Name string `json:"name"`
+	// Key of the file within the ConfigMap
+	Key string `json:"key"`
+}
+
+// WorkspaceSpec configures the volume the builds of a Custom Runtime Environment work in
+type WorkspaceSpec struct {
+	// VolumeClaimTemplate overrides the storage class, size and access modes of the PersistentVolumeClaim
+	// created for each build, which defaults to ReadWriteOnce 500Mi
+	// +optional
+	VolumeClaimTemplate corev1.PersistentVolumeClaimSpec `json:"volumeClaimTemplate,omitempty"`
+	// ClaimName is the name of an existing PersistentVolumeClaim the builds work in instead, each in a sub path
+	// named after the build
+	// +optional
+	ClaimName string `json:"claimName,omitempty"`
+}
+
+// FileSource is the content of a file used for building, either inline or from a ConfigMap.
+// Only one of the following may be specified.
+type FileSource struct {
+	// Content is the content of the file
+	// +optional
+	Content string `json:"content,omitempty"`
+	// ConfigMapKeyRef refers to the ConfigMap key holding the content of the file
+	// +optional
+	ConfigMapKeyRef *ConfigMapKeyReference `json:"configMapKeyRef,omitempty"`
+}
+
 // BuildTypeSpec is the strategy super-set of configurations for all strategies.
 type BuildTypeSpec struct {
 	// BuildType is the strategy
@@ -68,14 +205,65 @@ type BuildTypeSpec struct {
 	// Repository is the URL of the git repository, used for building
 	// +optional
 	Repository string `json:"repository,omitempty"`
-	// GitRef is the git reference within the Repository to use for building (e.g. "main")
+	// GitSecret is the secret used to clone the Repository if it is private, used for the GitRepository and
+	// Containerfile strategies
+	// +optional
+	GitSecret *GitSecret `json:"gitSecret,omitempty"`
+	// GitRef is the git reference within the Repository to use for building (e.g. "main"),
+	// defaults to the default branch of the Repository
 	// +optional
 	GitRef string `json:"gitRef,omitempty"`
-	// ImagePullSecret is the name of the secret to use for pulling the base image
+	// ContextDir is the directory within the Repository used as the build context, used for the Containerfile
+	// strategy, defaults to the root of the Repository
+	// +optional
+	ContextDir string `json:"contextDir,omitempty"`
+	// ContainerfilePath is the path of the Containerfile within the ContextDir, used for the Containerfile strategy,
+	// defaults to "Containerfile"
+	// +optional
+	ContainerfilePath string `json:"containerfilePath,omitempty"`
+	// Containerfile is the Containerfile to build instead of the one found in the Repository, used for the
+	// Containerfile strategy
+	// +optional
+	Containerfile *FileSource `json:"containerfile,omitempty"`
+	// EnvironmentFile is the Conda environment.yml, used for the CondaEnvironment strategy
+	// +optional
+	EnvironmentFile *FileSource `json:"environmentFile,omitempty"`
+	// Pipfile is the Pipfile, used for the Pipenv strategy
+	// +optional
+	Pipfile *FileSource `json:"pipfile,omitempty"`
+	// PipfileLock is the Pipfile.lock, used for the Pipenv strategy to install the exact versions it pins
+	// +optional
+	PipfileLock *FileSource `json:"pipfileLock,omitempty"`
+	// ImagePullSecret is the name of the secret to use for pulling the base image, or the image to import, of type
+	// kubernetes.io/dockerconfigjson. Not supported by the GitRepository and Containerfile strategies.
 	// +optional
 	ImagePullSecret ImagePullSecret `json:"imagePullSecret,omitempty"`
 }
 
+// DefaultBuildTimeout is the time a build may take if neither the CustomRuntimeEnvironment nor the operator
+// configuration set a BuildTimeout
+const DefaultBuildTimeout = time.Hour
+
+// DefaultBuildPendingTimeout is the time a build may wait for its first step to start if the operator configuration
+// does not set a BuildPendingTimeout, e.g. for its workspace to be bound or its images to be pulled
+const DefaultBuildPendingTimeout = 10 * time.Minute
+
+// DefaultRetryBackoff is the time waited before retrying a failed build if the RetryPolicy does not set a Backoff
+const DefaultRetryBackoff = 30 * time.Second
+
+// RetryPolicy retries the builds which failed for a reason that may be transient, i.e. not one of the well-known
+// failures of the build itself, such as invalid dependencies or a missing secret. Registry and network errors, such as
+// timeouts pulling or pushing an image, are transient.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a generation is built at most, including the first build and the
+	// builds retried by the retry annotation
+	// +kubebuilder:validation:Minimum=1
+	MaxAttempts int32 `json:"maxAttempts"`
+	// Backoff is the time waited before retrying a failed build, doubled for each further retry. Defaults to 30s.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+}
+
 // CustomRuntimeEnvironmentRuntimeSpec defines a Runtime Environment, aka 'the Python version used'
 type CustomRuntimeEnvironmentRuntimeSpec struct {
 	// PythonVersion is the version of Python to use
@@ -101,6 +289,177 @@ type CustomRuntimeEnvironmentSpec struct {
 	// +required
 	// +kubebuilder:Required
 	BuildTypeSpec `json:",inline"`
+	// LockMode controls whether a rebuild of a PackageList resolves the package versions again (Unlocked, the default)
+	// or reuses the pinned requirements recorded by the last successful build (Locked).
+	// +optional
+	LockMode LockMode `json:"lockMode,omitempty"`
+	// BuildHistoryLimit is the number of builds of previous generations to keep, including their PipelineRuns.
+	// Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	BuildHistoryLimit *int32 `json:"buildHistoryLimit,omitempty"`
+	// RetainPolicy controls whether the ImageStreams and workspaces produced by the builds are deleted (Delete, the default)
+	// or kept (Retain) when the Custom Runtime Environment is deleted.
+	// +optional
+	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
+	// BuildBackend selects what runs the builds, Tekton PipelineRuns or Kubernetes Jobs.
+	// Defaults to the build backend of the operator configuration.
+	// +optional
+	BuildBackend BuildBackend `json:"buildBackend,omitempty"`
+	// Workspace configures the volume the builds work in, its settings override the ones of the operator configuration
+	// +optional
+	Workspace *WorkspaceSpec `json:"workspace,omitempty"`
+	// CABundle is the ConfigMap key holding the CA certificates the builds trust, defaults to the one of the operator
+	// configuration, or the OpenShift service CA
+	// +optional
+	CABundle *ConfigMapKeyReference `json:"caBundle,omitempty"`
+	// RetryPolicy retries failed builds automatically, they are not retried unless it is set
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// BuildTimeout is the time a build may take, including the time it waits to be scheduled, before it is cancelled
+	// and fails. Defaults to the one of the operator configuration, or 1h.
+	// +optional
+	BuildTimeout *metav1.Duration `json:"buildTimeout,omitempty"`
+	// Priority orders the builds queued by the concurrency limits of the operator, builds of a higher priority are
+	// started first if the operator orders its queue by priority. Defaults to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// NoCache builds the image even if a CustomRuntimeEnvironment of the namespace has built one from the same inputs,
+	// instead of reusing it. Builds on base images referenced by tag only are not cached, unless the operator pins the
+	// tag to its digest.
+	// +optional
+	NoCache bool `json:"noCache,omitempty"`
+	// IgnoreBaseImageUpdates keeps the image when its base image is updated, instead of building it again on the
+	// updated base image
+	// +optional
+	IgnoreBaseImageUpdates bool `json:"ignoreBaseImageUpdates,omitempty"`
+	// RebuildSchedule builds the image again on a cron schedule in UTC, e.g. "0 3 * * 0" or "@weekly", so that it
+	// picks up the security fixes of its base image and packages. The previous image is kept until the new one is built.
+	// +optional
+	RebuildSchedule string `json:"rebuildSchedule,omitempty"`
+}
+
+// LockStatus describes the pinned requirements resolved by the last successful build of a PackageList
+type LockStatus struct {
+	// ConfigMapName is the name of the ConfigMap holding the pinned requirements, including their hashes
+	ConfigMapName string `json:"configMapName"`
+	// PipelineRunName is the name of the PipelineRun that resolved the pinned requirements
+	//+optional
+	PipelineRunName string `json:"pipelineRunName,omitempty"`
+	// PackageVersions are the packages including their version specifiers the pinned requirements were resolved from
+	//+optional
+	PackageVersions []string `json:"packageVersions,omitempty"`
+}
+
+// ImageStatus describes the container image produced by a build
+type ImageStatus struct {
+	// PullSpec is the fully qualified pull specification of the image
+	//+optional
+	PullSpec string `json:"pullSpec,omitempty"`
+	// Digest is the digest of the image, e.g. "sha256:..."
+	//+optional
+	Digest string `json:"digest,omitempty"`
+	// ImageStreamName is the name of the ImageStream referencing the image
+	//+optional
+	ImageStreamName string `json:"imageStreamName,omitempty"`
+	// ImageStreamTag is the tag within the ImageStream referencing the image
+	//+optional
+	ImageStreamTag string `json:"imageStreamTag,omitempty"`
+	// BaseImage is the image the build was based on, empty for imported images
+	//+optional
+	BaseImage string `json:"baseImage,omitempty"`
+	// BuildTime is the time the build of the image completed
+	//+optional
+	BuildTime *metav1.Time `json:"buildTime,omitempty"`
+	// BaseImageDigest is the digest of the base image the image was built against
+	//+optional
+	BaseImageDigest string `json:"baseImageDigest,omitempty"`
+	// CacheKey is the content hash of the normalised inputs the image was built from, empty if the build can not
+	// be reused, e.g. because it builds a git branch
+	//+optional
+	CacheKey string `json:"cacheKey,omitempty"`
+}
+
+// PinnedPullSpec returns the pull specification of the image pinned to its digest, if the digest is known
+func (i *ImageStatus) PinnedPullSpec() string {
+	if i.Digest == "" {
+		return i.PullSpec
+	}
+
+	repository := strings.SplitN(i.PullSpec, "@", 2)[0]
+	if slash, colon := strings.LastIndex(repository, "/"), strings.LastIndex(repository, ":"); colon > slash {
+		repository = repository[:colon]
+	}
+
+	return repository + "@" + i.Digest
+}
+
+// refersToImage returns true if the image reference refers to the image built by the Custom Runtime Environment,
+// either by its pull specification, by its digest or by its ImageStream tag
+func (cre *CustomRuntimeEnvironment) refersToImage(image string) bool {
+	status := cre.Status.Image
+	if status == nil || image == "" {
+		return false
+	}
+
+	if image == status.PullSpec || image == status.PinnedPullSpec() {
+		return true
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return false
+	}
+	if status.Digest != "" && ref.Identifier() == status.Digest {
+		return true
+	}
+
+	// e.g. image-registry.openshift-image-registry.svc:5000/<namespace>/<imagestream>:<tag>
+	return status.ImageStreamName != "" &&
+		ref.Context().RepositoryStr() == cre.Namespace+"/"+status.ImageStreamName &&
+		ref.Identifier() == status.ImageStreamTag
+}
+
+// BuildHistoryEntry is the result of a build of a previous generation of the Custom Runtime Environment
+type BuildHistoryEntry struct {
+	// Generation of the Custom Runtime Environment this build was run for
+	Generation int64 `json:"generation"`
+	// Name of the corresponding PipelineRun, or Job with the Job build backend
+	//+optional
+	PipelineRunName string `json:"pipelineRunName,omitempty"`
+	// Phase the build has reached before it was superseded
+	//+optional
+	Phase Phase `json:"phase,omitempty"`
+	// CompletionTime is the time the build completed, empty if it never completed
+	//+optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Image is the image produced by the build, empty unless the build succeeded
+	//+optional
+	Image *ImageStatus `json:"image,omitempty"`
+}
+
+// BuildFailure describes which step of a failed build failed, and why
+type BuildFailure struct {
+	// PipelineRunName is the name of the failed PipelineRun, or Job with the Job build backend
+	PipelineRunName string `json:"pipelineRunName"`
+	// TaskName is the name of the failed task within the pipeline, e.g. "resolve-dependencies" or "build-image"
+	//+optional
+	TaskName string `json:"taskName,omitempty"`
+	// TaskRunName is the name of the failed TaskRun, or Pod with the Job build backend
+	//+optional
+	TaskRunName string `json:"taskRunName,omitempty"`
+	// StepName is the name of the failed step within the task
+	//+optional
+	StepName string `json:"stepName,omitempty"`
+	// ExitCode is the exit code of the failed step
+	//+optional
+	ExitCode int32 `json:"exitCode,omitempty"`
+	// Reason is a brief reason for the failure, as reported by the TaskRun or the step
+	//+optional
+	Reason string `json:"reason,omitempty"`
+	// Message is the termination message of the failed step, or the message of the TaskRun if the step did not leave one
+	//+optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -121,12 +480,53 @@ type CustomRuntimeEnvironmentStatus struct {
 	// Stores results from pipelines. Empty if neither pipeline has completed.
 	//+optional
 	Pipelines []PipelineResult `json:"pipelines,omitempty"`
+	// BuildHistory holds the results of the builds of previous generations, most recent first.
+	//+optional
+	BuildHistory []BuildHistoryEntry `json:"buildHistory,omitempty"`
+	// Failure describes why the build of the current generation failed. Empty unless the build failed.
+	//+optional
+	Failure *BuildFailure `json:"failure,omitempty"`
+	// Image is the image produced by the most recent successful build
+	//+optional
+	Image *ImageStatus `json:"image,omitempty"`
+	// Lock describes the pinned requirements resolved by the most recent successful build of a PackageList
+	//+optional
+	Lock *LockStatus `json:"lock,omitempty"`
+	// ResolvedBaseImage is the base image the runtimeEnvironment of the current generation was resolved to
+	//+optional
+	ResolvedBaseImage string `json:"resolvedBaseImage,omitempty"`
+	// Retries is the number of times the build of the current generation was retried, on request or by the RetryPolicy
+	//+optional
+	Retries int32 `json:"retries,omitempty"`
+	// BuildCacheKey is the content hash of the normalised inputs of the build of the current generation
+	//+optional
+	BuildCacheKey string `json:"buildCacheKey,omitempty"`
+	// BuildBaseImageDigest is the digest of the base image the build of the current generation was submitted against
+	//+optional
+	BuildBaseImageDigest string `json:"buildBaseImageDigest,omitempty"`
+	// Rebuilds is the number of times the build of the current generation was started again by the rebuildSchedule or
+	// an update of the base image
+	//+optional
+	Rebuilds int32 `json:"rebuilds,omitempty"`
+	// LastScheduledBuildTime is the time the rebuildSchedule last started a build
+	//+optional
+	LastScheduledBuildTime *metav1.Time `json:"lastScheduledBuildTime,omitempty"`
+	// NextScheduledBuildTime is the time the rebuildSchedule starts the next build
+	//+optional
+	NextScheduledBuildTime *metav1.Time `json:"nextScheduledBuildTime,omitempty"`
+	// QueuePosition is the position of the build in the queue while the concurrency limits of the operator are
+	// reached, starting at 1
+	//+optional
+	QueuePosition int32 `json:"queuePosition,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:shortName=cre,categories=opendatahub
 //+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Phase"
+//+kubebuilder:printcolumn:name="Queue",type="integer",JSONPath=".status.queuePosition",description="Position in the build queue",priority=1
+//+kubebuilder:printcolumn:name="Image",type="string",JSONPath=".status.image.pullSpec",description="Image"
+//+kubebuilder:printcolumn:name="Digest",type="string",JSONPath=".status.image.digest",description="Image digest",priority=1
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // CustomRuntimeEnvironment is the Schema for the customruntimeenvironments API
@@ -151,8 +551,8 @@ type CustomRuntimeEnvironmentList struct {
 func (cre *CustomRuntimeEnvironment) AggregatePhase() Phase {
 	pipelineRunCreated := false
 	pipelineRunSuccesseded := false
-	importReady := false
-	packageListBuildCompleted := false
+	buildCompleted := false
+	buildCondition, hasBuildCondition := BuildConditions[cre.Spec.BuildType]
 
 	if len(cre.Status.Conditions) == 0 {
 		return PhasePending
@@ -167,25 +567,41 @@ func (cre *CustomRuntimeEnvironment) AggregatePhase() Phase {
 			return PhaseFailed
 		}
 
+		if c.Type == ErrorResolvingBaseImage && c.Status == metav1.ConditionTrue {
+			return PhaseFailed
+		}
+
+		if c.Type == BuildBackendUnavailable && c.Status == metav1.ConditionTrue {
+			return PhaseFailed
+		}
+
+		if c.Type == ErrorEvaluatingParamTemplate && c.Status == metav1.ConditionTrue {
+			return PhaseFailed
+		}
+
 		if c.Type == PipelineRunCreated && c.Status == metav1.ConditionTrue {
 			pipelineRunCreated = true
 		}
 
-		if c.Type == ImageImportReady {
-			if c.Status == metav1.ConditionTrue {
-				importReady = true
-			}
+		if hasBuildCondition && c.Type == buildCondition.Type && c.Status == metav1.ConditionTrue {
+			buildCompleted = true
 		}
 
-		if c.Type == PackageListBuildCompleted {
-			if c.Status == metav1.ConditionTrue {
-				packageListBuildCompleted = true
-			}
+		if c.Type == ImageImportInvalid && c.Status == metav1.ConditionTrue {
+			return PhaseFailed
 		}
 
-		if c.Type == ImageImportInvalid && c.Status == metav1.ConditionTrue {
+		if c.Type == BuildTimedOut && c.Status == metav1.ConditionTrue {
 			return PhaseFailed
 		}
+
+		if c.Type == BuildCancelled && c.Status == metav1.ConditionTrue {
+			return PhaseCancelled
+		}
+
+		if c.Type == BuildQueued && c.Status == metav1.ConditionTrue {
+			return PhaseQueued
+		}
 	}
 
 	if pipelineRunCreated {
@@ -193,7 +609,7 @@ func (cre *CustomRuntimeEnvironment) AggregatePhase() Phase {
 	}
 
 	if pipelineRunSuccesseded {
-		if importReady || packageListBuildCompleted {
+		if buildCompleted {
 			return PhaseSucceeded
 		} else {
 			return PhaseFailed
@@ -203,6 +619,118 @@ func (cre *CustomRuntimeEnvironment) AggregatePhase() Phase {
 	return PhasePending
 }
 
+// GetBuildHistoryLimit returns the number of previous generations' builds to keep
+func (cre *CustomRuntimeEnvironment) GetBuildHistoryLimit() int {
+	if cre.Spec.BuildHistoryLimit == nil {
+		return DefaultBuildHistoryLimit
+	}
+	return int(*cre.Spec.BuildHistoryLimit)
+}
+
+// GetRetryBackoff returns the time to wait before the given retry of a failed build, the backoff doubles for each
+// retry of the same generation
+func (cre *CustomRuntimeEnvironment) GetRetryBackoff(retry int32) time.Duration {
+	backoff := DefaultRetryBackoff
+	if policy := cre.Spec.RetryPolicy; policy != nil && policy.Backoff != nil {
+		backoff = policy.Backoff.Duration
+	}
+	for i := int32(1); i < retry; i++ {
+		backoff *= 2
+	}
+
+	return backoff
+}
+
+// resetBuildConditions removes the conditions describing the build of the current generation
+func (cre *CustomRuntimeEnvironment) resetBuildConditions() {
+	for _, conditionType := range buildScopedConditions {
+		meta.RemoveStatusCondition(&cre.Status.Conditions, conditionType)
+	}
+}
+
+// RetryBuild counts a retry of the build of the current generation and resets its conditions and failure, so that
+// the retried build starts from a clean state. The image of the previous build is kept until the retried one succeeds.
+func (cre *CustomRuntimeEnvironment) RetryBuild() {
+	cre.Status.Retries++
+	cre.Status.QueuePosition = 0
+	cre.resetBuildConditions()
+	cre.Status.Failure = nil
+	cre.Status.Phase = PhasePending
+}
+
+// Rebuild counts a new build of the current generation with unchanged spec, and resets its conditions, failure and
+// pipeline results. The image of the previous build is kept until the new one succeeds.
+func (cre *CustomRuntimeEnvironment) Rebuild() {
+	cre.Status.Rebuilds++
+	cre.Status.Retries = 0
+	cre.Status.QueuePosition = 0
+	cre.resetBuildConditions()
+	cre.Status.Pipelines = nil
+	cre.Status.Failure = nil
+	cre.Status.Phase = PhasePending
+}
+
+// ScheduleBuild starts a new build of the current generation by the rebuildSchedule at the given time, see Rebuild,
+// and records when the schedule is due next
+func (cre *CustomRuntimeEnvironment) ScheduleBuild(now metav1.Time, next *metav1.Time) {
+	cre.Rebuild()
+	cre.Status.LastScheduledBuildTime = &now
+	cre.Status.NextScheduledBuildTime = next
+}
+
+// ArchiveBuild records the build of the last observed generation in the build history and resets
+// the conditions and pipeline results, so that the build of the current generation starts from a
+// clean state. The build history is trimmed to the build history limit.
+func (cre *CustomRuntimeEnvironment) ArchiveBuild() {
+	entry := BuildHistoryEntry{
+		Generation: cre.Status.ObservedGeneration,
+		Phase:      cre.AggregatePhase(),
+	}
+	if len(cre.Status.Pipelines) > 0 {
+		entry.PipelineRunName = cre.Status.Pipelines[0].PipelineRunName
+	}
+	if c := meta.FindStatusCondition(cre.Status.Conditions, PipelineRunCompleted); c != nil && c.Status == metav1.ConditionTrue {
+		completionTime := c.LastTransitionTime
+		entry.CompletionTime = &completionTime
+	}
+	if entry.Phase == PhaseSucceeded && cre.Status.Image != nil {
+		entry.Image = cre.Status.Image.DeepCopy()
+	}
+
+	cre.Status.BuildHistory = append([]BuildHistoryEntry{entry}, cre.Status.BuildHistory...)
+	if limit := cre.GetBuildHistoryLimit(); len(cre.Status.BuildHistory) > limit {
+		cre.Status.BuildHistory = cre.Status.BuildHistory[:limit]
+	}
+
+	cre.resetBuildConditions()
+	cre.Status.Pipelines = nil
+	cre.Status.Failure = nil
+	cre.Status.ResolvedBaseImage = ""
+	cre.Status.Retries = 0
+	cre.Status.Rebuilds = 0
+	cre.Status.NextScheduledBuildTime = nil
+	cre.Status.QueuePosition = 0
+	cre.Status.BuildCacheKey = ""
+	cre.Status.BuildBaseImageDigest = ""
+	cre.Status.Phase = PhasePending
+}
+
+// HasMatchingLock returns true if the pinned requirements of a previous build have been resolved from
+// the current package versions, so they can be reused for a rebuild
+func (cre *CustomRuntimeEnvironment) HasMatchingLock() bool {
+	if cre.Status.Lock == nil || len(cre.Status.Lock.PackageVersions) != len(cre.Spec.PackageVersions) {
+		return false
+	}
+
+	for i, packageVersion := range cre.Spec.PackageVersions {
+		if cre.Status.Lock.PackageVersions[i] != packageVersion {
+			return false
+		}
+	}
+
+	return true
+}
+
 // IsReady returns true the Ready condition status is True
 func (status CustomRuntimeEnvironmentStatus) IsReady() bool {
 	for _, condition := range status.Conditions {
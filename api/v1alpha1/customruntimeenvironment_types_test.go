@@ -17,8 +17,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -344,6 +347,190 @@ func TestAggregatePhase(t *testing.T) {
 			},
 			expectedOutput: PhaseFailed,
 		},
+		"base-image-unresolved": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   ErrorResolvingBaseImage,
+							Status: metav1.ConditionTrue,
+							Reason: "RuntimeEnvironmentNotInCatalog",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
+		"build-backend-unavailable": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   BuildBackendUnavailable,
+							Status: metav1.ConditionTrue,
+							Reason: "BuildBackendUnavailable",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
+		"param-template-invalid": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   ErrorEvaluatingParamTemplate,
+							Status: metav1.ConditionTrue,
+							Reason: "InvalidParamTemplate",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
+		"conda-environment-successful": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:       CondaEnvironment,
+						BaseImage:       "quay.io/jupyter/minimal-notebook:latest",
+						EnvironmentFile: &FileSource{Content: "dependencies:\n  - pandas\n"},
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCompleted",
+						},
+						{
+							Type:   CondaEnvironmentBuildCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "CondaEnvironmentBuildCompleted",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseSucceeded,
+		},
+		"pipenv-failed": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: Pipenv,
+						BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+						Pipfile:   &FileSource{Content: "[packages]\npandas = \"*\"\n"},
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCompleted",
+						},
+						{
+							Type:   PipenvBuildCompleted,
+							Status: metav1.ConditionFalse,
+							Reason: "PipenvBuildCompleted",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
+		"containerfile-successful": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:     Containerfile,
+						Containerfile: &FileSource{Content: "FROM quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2\n"},
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCompleted",
+						},
+						{
+							Type:   ContainerfileBuildCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "ContainerfileBuildCompleted",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseSucceeded,
+		},
+		"gitrepository-successful": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCompleted",
+						},
+						{
+							Type:   GitRepositoryBuildCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "GitRepositoryBuildCompleted",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseSucceeded,
+		},
+		"other-build-type-condition": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCompleted",
+						},
+						{
+							Type:   PackageListBuildCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PackageListBuildCompleted",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
 		"packagelist-successful": { // regression test for #157
 			cre: CustomRuntimeEnvironment{
 				Spec: CustomRuntimeEnvironmentSpec{
@@ -371,6 +558,74 @@ func TestAggregatePhase(t *testing.T) {
 			},
 			expectedOutput: PhaseSucceeded,
 		},
+		"cancelled": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+					},
+					PackageVersions: []string{"numpy", "pandas"},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCompleted,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCancelled",
+						},
+						{
+							Type:   BuildCancelled,
+							Status: metav1.ConditionTrue,
+							Reason: "BuildCancelled",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseCancelled,
+		},
+		"queued": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   BuildQueued,
+							Status: metav1.ConditionTrue,
+							Reason: "ConcurrencyLimitReached",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseQueued,
+		},
+		"timed-out": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					Conditions: []metav1.Condition{
+						{
+							Type:   BuildTimedOut,
+							Status: metav1.ConditionTrue,
+							Reason: "BuildPendingTimeout",
+						},
+						{
+							Type:   BuildCancelled,
+							Status: metav1.ConditionTrue,
+							Reason: "BuildCancelled",
+						},
+					},
+				},
+			},
+			expectedOutput: PhaseFailed,
+		},
 	}
 
 	for tcName, tc := range testCases {
@@ -379,3 +634,371 @@ func TestAggregatePhase(t *testing.T) {
 		}
 	}
 }
+
+// TestArchiveBuild tests if the build of the previous generation is moved to the build history
+func TestArchiveBuild(t *testing.T) {
+	completed := metav1.Now()
+	historyLimit := int32(1)
+
+	testCases := map[string]struct {
+		cre             CustomRuntimeEnvironment
+		expectedHistory []BuildHistoryEntry
+	}{
+		"succeeded": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					ObservedGeneration: 1,
+					Pipelines: []PipelineResult{
+						{Name: "test", PipelineRunName: "cre-test-1-import"},
+					},
+					Conditions: []metav1.Condition{
+						{
+							Type:               ImageImportReady,
+							Status:             metav1.ConditionTrue,
+							Reason:             "ImageImportReady",
+							LastTransitionTime: completed,
+						},
+						{
+							Type:               PipelineRunCompleted,
+							Status:             metav1.ConditionTrue,
+							Reason:             "PipelineRunCompleted",
+							LastTransitionTime: completed,
+						},
+					},
+				},
+			},
+			expectedHistory: []BuildHistoryEntry{
+				{Generation: 1, PipelineRunName: "cre-test-1-import", Phase: PhaseSucceeded, CompletionTime: &completed},
+			},
+		},
+		"superseded-while-running": {
+			cre: CustomRuntimeEnvironment{
+				Status: CustomRuntimeEnvironmentStatus{
+					ObservedGeneration: 2,
+					Pipelines: []PipelineResult{
+						{Name: "test", PipelineRunName: "cre-test-2-import"},
+					},
+					Conditions: []metav1.Condition{
+						{
+							Type:   PipelineRunCreated,
+							Status: metav1.ConditionTrue,
+							Reason: "PipelineRunCreated",
+						},
+					},
+					BuildHistory: []BuildHistoryEntry{
+						{Generation: 1, PipelineRunName: "cre-test-1-import", Phase: PhaseSucceeded, CompletionTime: &completed},
+					},
+				},
+			},
+			expectedHistory: []BuildHistoryEntry{
+				{Generation: 2, PipelineRunName: "cre-test-2-import", Phase: PhaseRunning},
+				{Generation: 1, PipelineRunName: "cre-test-1-import", Phase: PhaseSucceeded, CompletionTime: &completed},
+			},
+		},
+		"history-limit": {
+			cre: CustomRuntimeEnvironment{
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildHistoryLimit: &historyLimit,
+				},
+				Status: CustomRuntimeEnvironmentStatus{
+					ObservedGeneration: 2,
+					ResolvedBaseImage:  "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+					Pipelines: []PipelineResult{
+						{Name: "test", PipelineRunName: "cre-test-2-import"},
+					},
+					BuildHistory: []BuildHistoryEntry{
+						{Generation: 1, PipelineRunName: "cre-test-1-import", Phase: PhaseSucceeded, CompletionTime: &completed},
+					},
+				},
+			},
+			expectedHistory: []BuildHistoryEntry{
+				{Generation: 2, PipelineRunName: "cre-test-2-import", Phase: PhasePending},
+			},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		tc.cre.ArchiveBuild()
+
+		if !reflect.DeepEqual(tc.cre.Status.BuildHistory, tc.expectedHistory) {
+			t.Errorf("%s Got build history %v while expecting %v", tcName, tc.cre.Status.BuildHistory, tc.expectedHistory)
+		}
+		if len(tc.cre.Status.Conditions) != 0 || len(tc.cre.Status.Pipelines) != 0 {
+			t.Errorf("%s Got conditions %v and pipelines %v while expecting none", tcName, tc.cre.Status.Conditions, tc.cre.Status.Pipelines)
+		}
+		if tc.cre.Status.Phase != PhasePending {
+			t.Errorf("%s Got %s while expecting %s", tcName, tc.cre.Status.Phase, PhasePending)
+		}
+		if tc.cre.Status.ResolvedBaseImage != "" {
+			t.Errorf("%s Got resolved base image %s while expecting none", tcName, tc.cre.Status.ResolvedBaseImage)
+		}
+	}
+}
+
+// TestGetRetryBackoff tests if the backoff of the retry policy, or the default one, doubles for each retry
+func TestGetRetryBackoff(t *testing.T) {
+	testCases := map[string]struct {
+		policy         *RetryPolicy
+		retry          int32
+		expectedOutput time.Duration
+	}{
+		"default": {
+			retry:          1,
+			expectedOutput: DefaultRetryBackoff,
+		},
+		"default-third-retry": {
+			retry:          3,
+			expectedOutput: 4 * DefaultRetryBackoff,
+		},
+		"policy-without-backoff": {
+			policy:         &RetryPolicy{MaxAttempts: 3},
+			retry:          2,
+			expectedOutput: 2 * DefaultRetryBackoff,
+		},
+		"policy-backoff": {
+			policy:         &RetryPolicy{MaxAttempts: 3, Backoff: &metav1.Duration{Duration: time.Minute}},
+			retry:          2,
+			expectedOutput: 2 * time.Minute,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := CustomRuntimeEnvironment{Spec: CustomRuntimeEnvironmentSpec{RetryPolicy: tc.policy}}
+
+		if output := cre.GetRetryBackoff(tc.retry); output != tc.expectedOutput {
+			t.Errorf("%s Got %s while expecting %s", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestRetryBuild tests if a retry is counted and the outcome of the previous build is reset, but not its image
+func TestRetryBuild(t *testing.T) {
+	cre := CustomRuntimeEnvironment{
+		Status: CustomRuntimeEnvironmentStatus{
+			Phase:   PhaseFailed,
+			Retries: 1,
+			Conditions: []metav1.Condition{
+				{Type: PipelineRunCompleted, Status: metav1.ConditionTrue, Reason: "PipelineRunCompleted"},
+			},
+			Failure: &BuildFailure{TaskName: "build-image"},
+			Image:   &ImageStatus{PullSpec: "quay.io/thoth-station/cre-test-1-package-list:latest"},
+		},
+	}
+
+	cre.RetryBuild()
+
+	if cre.Status.Retries != 2 {
+		t.Errorf("Got %d retries while expecting 2", cre.Status.Retries)
+	}
+	if len(cre.Status.Conditions) != 0 || cre.Status.Failure != nil || cre.Status.Phase != PhasePending {
+		t.Errorf("Got conditions %v, failure %v and phase %s while expecting none and %s", cre.Status.Conditions, cre.Status.Failure, cre.Status.Phase, PhasePending)
+	}
+	if cre.Status.Image == nil {
+		t.Errorf("Got no image while expecting the one of the previous build")
+	}
+}
+
+// TestResetBuildConditions tests if starting another build resets the conditions of the previous build, but keeps the
+// ones describing the CustomRuntimeEnvironment itself
+func TestResetBuildConditions(t *testing.T) {
+	testCases := map[string]func(cre *CustomRuntimeEnvironment){
+		"archive": (*CustomRuntimeEnvironment).ArchiveBuild,
+		"retry":   (*CustomRuntimeEnvironment).RetryBuild,
+		"rebuild": (*CustomRuntimeEnvironment).Rebuild,
+	}
+
+	for tcName, reset := range testCases {
+		cre := &CustomRuntimeEnvironment{
+			Status: CustomRuntimeEnvironmentStatus{
+				Conditions: []metav1.Condition{
+					{Type: PipelineRunCompleted, Status: metav1.ConditionTrue, Reason: "PipelineRunCompleted"},
+					{Type: PackageListBuildCompleted, Status: metav1.ConditionFalse, Reason: "PackageListBuildCompleted"},
+					{Type: RequiredSecretMissing, Status: metav1.ConditionTrue, Reason: "SecretNotFound"},
+					{Type: CacheHit, Status: metav1.ConditionTrue, Reason: "BuildCacheHit"},
+				},
+			},
+		}
+
+		reset(cre)
+
+		if len(cre.Status.Conditions) != 2 {
+			t.Errorf("%s Got conditions %v while expecting %s and %s only", tcName, cre.Status.Conditions, RequiredSecretMissing, CacheHit)
+		}
+		for _, conditionType := range []string{RequiredSecretMissing, CacheHit} {
+			if !meta.IsStatusConditionTrue(cre.Status.Conditions, conditionType) {
+				t.Errorf("%s Got conditions %v while expecting %s to be kept", tcName, cre.Status.Conditions, conditionType)
+			}
+		}
+	}
+}
+
+// TestScheduleBuild tests if a scheduled build is counted and recorded, and the outcome of the previous build is reset,
+// but not its image
+func TestScheduleBuild(t *testing.T) {
+	now := metav1.Now()
+	next := metav1.NewTime(now.Add(7 * 24 * time.Hour))
+	cre := CustomRuntimeEnvironment{
+		Status: CustomRuntimeEnvironmentStatus{
+			Phase:   PhaseSucceeded,
+			Retries: 1,
+			Conditions: []metav1.Condition{
+				{Type: PipelineRunCompleted, Status: metav1.ConditionTrue, Reason: "PipelineRunCompleted"},
+			},
+			Image: &ImageStatus{PullSpec: "quay.io/thoth-station/cre-test-1-package-list:latest"},
+		},
+	}
+
+	cre.ScheduleBuild(now, &next)
+
+	if cre.Status.Rebuilds != 1 || cre.Status.Retries != 0 {
+		t.Errorf("Got %d rebuilds and %d retries while expecting 1 and 0", cre.Status.Rebuilds, cre.Status.Retries)
+	}
+	if !cre.Status.LastScheduledBuildTime.Equal(&now) || !cre.Status.NextScheduledBuildTime.Equal(&next) {
+		t.Errorf("Got last and next scheduled build times %v and %v while expecting %v and %v", cre.Status.LastScheduledBuildTime, cre.Status.NextScheduledBuildTime, now, next)
+	}
+	if len(cre.Status.Conditions) != 0 || cre.Status.Phase != PhasePending {
+		t.Errorf("Got conditions %v and phase %s while expecting none and %s", cre.Status.Conditions, cre.Status.Phase, PhasePending)
+	}
+	if cre.Status.Image == nil {
+		t.Errorf("Got no image while expecting the one of the previous build")
+	}
+}
+
+// TestPinnedPullSpec tests if the pull spec of an image is pinned to its digest
+func TestPinnedPullSpec(t *testing.T) {
+	testCases := map[string]struct {
+		image          ImageStatus
+		expectedOutput string
+	}{
+		"no-digest": {
+			image:          ImageStatus{PullSpec: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2"},
+			expectedOutput: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+		},
+		"tag": {
+			image:          ImageStatus{PullSpec: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2", Digest: "sha256:0123"},
+			expectedOutput: "quay.io/thoth-station/s2i-minimal-py38-notebook@sha256:0123",
+		},
+		"registry-port": {
+			image:          ImageStatus{PullSpec: "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list", Digest: "sha256:0123"},
+			expectedOutput: "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list@sha256:0123",
+		},
+		"already-pinned": {
+			image:          ImageStatus{PullSpec: "quay.io/thoth-station/s2i-minimal-py38-notebook@sha256:0123", Digest: "sha256:0123"},
+			expectedOutput: "quay.io/thoth-station/s2i-minimal-py38-notebook@sha256:0123",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := tc.image.PinnedPullSpec(); output != tc.expectedOutput {
+			t.Errorf("%s Got %s while expecting %s", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestHasMatchingLock tests if the pinned requirements are only reused for unchanged package versions
+func TestHasMatchingLock(t *testing.T) {
+	testCases := map[string]struct {
+		packageVersions []string
+		lock            *LockStatus
+		expectedOutput  bool
+	}{
+		"no-lock": {
+			packageVersions: []string{"pandas", "boto3>=1.24.0"},
+			lock:            nil,
+			expectedOutput:  false,
+		},
+		"unchanged": {
+			packageVersions: []string{"pandas", "boto3>=1.24.0"},
+			lock:            &LockStatus{ConfigMapName: "test-lock", PackageVersions: []string{"pandas", "boto3>=1.24.0"}},
+			expectedOutput:  true,
+		},
+		"package-added": {
+			packageVersions: []string{"pandas", "boto3>=1.24.0", "numpy"},
+			lock:            &LockStatus{ConfigMapName: "test-lock", PackageVersions: []string{"pandas", "boto3>=1.24.0"}},
+			expectedOutput:  false,
+		},
+		"specifier-changed": {
+			packageVersions: []string{"pandas", "boto3>=1.25.0"},
+			lock:            &LockStatus{ConfigMapName: "test-lock", PackageVersions: []string{"pandas", "boto3>=1.24.0"}},
+			expectedOutput:  false,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := CustomRuntimeEnvironment{
+			Spec: CustomRuntimeEnvironmentSpec{
+				BuildTypeSpec:   BuildTypeSpec{BuildType: PackageList},
+				PackageVersions: tc.packageVersions,
+				LockMode:        Locked,
+			},
+			Status: CustomRuntimeEnvironmentStatus{Lock: tc.lock},
+		}
+		if output := cre.HasMatchingLock(); output != tc.expectedOutput {
+			t.Errorf("%s Got %t while expecting %t", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestRefersToImage tests if references to the image built by a CustomRuntimeEnvironment are recognized
+func TestRefersToImage(t *testing.T) {
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cre := CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Status: CustomRuntimeEnvironmentStatus{
+			Image: &ImageStatus{
+				PullSpec:        "quay.io/thoth-station/test:latest",
+				Digest:          digest,
+				ImageStreamName: "cre-test-1-package-list",
+				ImageStreamTag:  "latest",
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		image          string
+		expectedOutput bool
+	}{
+		"empty":            {image: "", expectedOutput: false},
+		"pull-spec":        {image: "quay.io/thoth-station/test:latest", expectedOutput: true},
+		"pinned":           {image: "quay.io/thoth-station/test@" + digest, expectedOutput: true},
+		"digest":           {image: "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list@" + digest, expectedOutput: true},
+		"image-stream-tag": {image: "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list:latest", expectedOutput: true},
+		"other-tag":        {image: "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list:v1", expectedOutput: false},
+		"other-namespace":  {image: "image-registry.openshift-image-registry.svc:5000/other/cre-test-1-package-list:latest", expectedOutput: false},
+		"other-image":      {image: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2", expectedOutput: false},
+		"not-a-reference":  {image: "not a reference", expectedOutput: false},
+	}
+
+	for tcName, tc := range testCases {
+		if output := cre.refersToImage(tc.image); output != tc.expectedOutput {
+			t.Errorf("%s Got %t while expecting %t", tcName, output, tc.expectedOutput)
+		}
+	}
+
+	if (&CustomRuntimeEnvironment{}).refersToImage("quay.io/thoth-station/test:latest") {
+		t.Errorf("no-image Got true while expecting false")
+	}
+}
+
+// TestBuildConditions tests that every build type reports the outcome of its builds with a condition of its own
+func TestBuildConditions(t *testing.T) {
+	buildTypes := []BuildType{ImportImage, PackageList, GitRepository, CondaEnvironment, Pipenv, Containerfile}
+
+	seen := map[string]BuildType{}
+	for _, buildType := range buildTypes {
+		condition, ok := BuildConditions[buildType]
+		if !ok {
+			t.Errorf("%s Got no build condition while expecting one", buildType)
+			continue
+		}
+		if other, ok := seen[condition.Type]; ok {
+			t.Errorf("%s Got build condition %s while expecting it to differ from the one of %s", buildType, condition.Type, other)
+		}
+		seen[condition.Type] = buildType
+	}
+}
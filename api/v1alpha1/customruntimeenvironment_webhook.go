@@ -19,21 +19,42 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// scpLikeGitURLRegexp matches the scp-like syntax of ssh git URLs, e.g. "git@github.com:thoth-station/meteor.git"
+var scpLikeGitURLRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/:][^:]*$`)
+
 // log is for logging in this package.
 var customruntimeenvironmentlog = logf.Log.WithName("customruntimeenvironment-resource")
 
-func (r *CustomRuntimeEnvironment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+func (r *CustomRuntimeEnvironment) SetupWebhookWithManager(mgr ctrl.Manager, config CustomRuntimeEnvironmentConfig) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(&customRuntimeEnvironmentDefaulter{config: config}).
+		WithValidator(&customRuntimeEnvironmentValidator{client: mgr.GetAPIReader()}).
 		Complete()
 }
 
@@ -41,60 +62,438 @@ func (r *CustomRuntimeEnvironment) SetupWebhookWithManager(mgr ctrl.Manager) err
 
 var _ webhook.Defaulter = &CustomRuntimeEnvironment{}
 
-// Default implements webhook.Defaulter so a webhook will be registered for the type
+// Default implements webhook.Defaulter, it sets the defaults which depend on the object only
 func (r *CustomRuntimeEnvironment) Default() {
 	customruntimeenvironmentlog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	if _, ok := r.Annotations[CRENameAnnotationKey]; !ok {
+		metav1.SetMetaDataAnnotation(&r.ObjectMeta, CRENameAnnotationKey, r.Name)
+	}
+
+	if r.Spec.BuildType == GitRepository && r.Spec.GitRef == "" {
+		r.Spec.GitRef = DefaultGitRef
+	}
+
+	if r.Spec.BuildType == Containerfile && r.Spec.Repository != "" {
+		if r.Spec.GitRef == "" {
+			r.Spec.GitRef = DefaultGitRef
+		}
+		if r.Spec.ContainerfilePath == "" && r.Spec.Containerfile == nil {
+			r.Spec.ContainerfilePath = DefaultContainerfilePath
+		}
+	}
+
+	r.defaultPackageVersions()
+}
+
+var _ webhook.CustomDefaulter = &customRuntimeEnvironmentDefaulter{}
+
+// customRuntimeEnvironmentDefaulter sets the defaults which depend on the admission request or on the
+// operator-level configuration, in addition to the ones set by CustomRuntimeEnvironment.Default()
+type customRuntimeEnvironmentDefaulter struct {
+	config CustomRuntimeEnvironmentConfig
+}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *customRuntimeEnvironmentDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*CustomRuntimeEnvironment)
+	if !ok {
+		return fmt.Errorf("expected a CustomRuntimeEnvironment but got a %T", obj)
+	}
+
+	r.Default()
+
+	// the creator is whoever creates the object, it is not changed by later updates
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation == admissionv1.Create {
+		if _, ok := r.Annotations[CRECreatorAnnotationKey]; !ok && req.UserInfo.Username != "" {
+			metav1.SetMetaDataAnnotation(&r.ObjectMeta, CRECreatorAnnotationKey, req.UserInfo.Username)
+		}
+	}
+
+	if r.Spec.BuildType.BuildsOnBaseImage() && r.Spec.BaseImage == "" {
+		r.defaultRuntimeEnvironment(d.config.DefaultRuntimeEnvironment)
+	}
+
+	return nil
+}
+
+// defaultRuntimeEnvironment sets the fields of the runtimeEnvironment which are not set from the given defaults
+func (r *CustomRuntimeEnvironment) defaultRuntimeEnvironment(defaults CustomRuntimeEnvironmentRuntimeSpec) {
+	if r.Spec.RuntimeEnvironment.OSName == "" {
+		r.Spec.RuntimeEnvironment.OSName = defaults.OSName
+	}
+	if r.Spec.RuntimeEnvironment.OSVersion == "" {
+		r.Spec.RuntimeEnvironment.OSVersion = defaults.OSVersion
+	}
+	if r.Spec.RuntimeEnvironment.PythonVersion == "" {
+		r.Spec.RuntimeEnvironment.PythonVersion = defaults.PythonVersion
+	}
 }
 
-//+kubebuilder:webhook:path=/validate-meteor-zone-v1alpha1-customruntimeenvironment,mutating=false,failurePolicy=fail,sideEffects=None,groups=meteor.zone,resources=customruntimeenvironments,verbs=create;update,versions=v1alpha1,name=vcustomruntimeenvironment.kb.io,admissionReviewVersions=v1
+// defaultPackageVersions normalizes the package names of packageVersions as specified by PEP 503,
+// malformed requirements are left untouched so that validation can reject them
+func (r *CustomRuntimeEnvironment) defaultPackageVersions() {
+	for i, packageVersion := range r.Spec.PackageVersions {
+		requirement, err := parseRequirement(packageVersion)
+		if err != nil {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(packageVersion)
+		r.Spec.PackageVersions[i] = normalizePackageName(requirement.name) + trimmed[len(requirement.name):]
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-meteor-zone-v1alpha1-customruntimeenvironment,mutating=false,failurePolicy=fail,sideEffects=None,groups=meteor.zone,resources=customruntimeenvironments,verbs=create;update;delete,versions=v1alpha1,name=vcustomruntimeenvironment.kb.io,admissionReviewVersions=v1
 
 var _ webhook.Validator = &CustomRuntimeEnvironment{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+// ValidateCreate implements webhook.Validator
 func (r *CustomRuntimeEnvironment) ValidateCreate() error {
 	customruntimeenvironmentlog.Info("validate create", "name", r.Name)
 
 	return r.ValidateCustomRuntimeEnvironment()
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+// ValidateUpdate implements webhook.Validator, the spec is validated again only if it changed, so that the updates
+// of the metadata are not rejected for a spec validated by an earlier version of the webhook. The spec is not
+// validated at all once the CustomRuntimeEnvironment is being deleted, so that its finalizer can be removed.
 func (r *CustomRuntimeEnvironment) ValidateUpdate(old runtime.Object) error {
 	customruntimeenvironmentlog.Info("validate update", "name", r.Name)
 
+	oldCRE, ok := old.(*CustomRuntimeEnvironment)
+	if !ok {
+		return fmt.Errorf("expected a CustomRuntimeEnvironment but got a %T", old)
+	}
+
+	allErrs := r.validateCustomRuntimeEnvironmentUpdate(oldCRE)
+	if len(allErrs) != 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: Group, Kind: "CustomRuntimeEnvironment"},
+			r.Name, allErrs)
+	}
+
+	if !r.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if equality.Semantic.DeepEqual(r.Spec, oldCRE.Spec) {
+		if allErrs := r.validateCustomRuntimeEnvironmentAnnotations(); len(allErrs) != 0 {
+			return apierrors.NewInvalid(
+				schema.GroupKind{Group: Group, Kind: "CustomRuntimeEnvironment"},
+				r.Name, allErrs)
+		}
+		return nil
+	}
+
 	return r.ValidateCustomRuntimeEnvironment()
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// validateCustomRuntimeEnvironmentUpdate checks the transition from the old to the updated CustomRuntimeEnvironment
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentUpdate(old *CustomRuntimeEnvironment) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.BuildType != old.Spec.BuildType {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.buildType"), "buildType is immutable"))
+	}
+
+	if creator, ok := old.Annotations[CRECreatorAnnotationKey]; ok && r.Annotations[CRECreatorAnnotationKey] != creator {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("metadata.annotations").Key(CRECreatorAnnotationKey), "annotation is immutable"))
+	}
+
+	if old.Status.Phase == PhaseRunning && !equality.Semantic.DeepEqual(r.Spec, old.Spec) {
+		if _, ok := r.Annotations[CREForceRebuildAnnotationKey]; !ok {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"),
+				fmt.Sprintf("spec cannot be changed while a build is running, unless the %s annotation is set", CREForceRebuildAnnotationKey)))
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateDelete implements webhook.Validator, the references to the image which prevent the deletion
+// are checked by customRuntimeEnvironmentValidator
 func (r *CustomRuntimeEnvironment) ValidateDelete() error {
 	customruntimeenvironmentlog.Info("validate delete", "name", r.Name)
 
-	// TODO change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-	// TODO fill in your validation logic upon object deletion.
 	return nil
 }
 
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=list
+//+kubebuilder:rbac:groups=meteor.zone,resources=runtimeenvironmentcatalogs,verbs=list
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+
+var _ webhook.CustomValidator = &customRuntimeEnvironmentValidator{}
+
+// customRuntimeEnvironmentValidator runs the validations of CustomRuntimeEnvironment, and the ones which
+// depend on other objects of the cluster
+type customRuntimeEnvironmentValidator struct {
+	client client.Reader
+}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *customRuntimeEnvironmentValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*CustomRuntimeEnvironment)
+	if !ok {
+		return fmt.Errorf("expected a CustomRuntimeEnvironment but got a %T", obj)
+	}
+
+	if err := r.ValidateCreate(); err != nil {
+		return err
+	}
+
+	if err := v.validateGitSecret(ctx, r); err != nil {
+		return err
+	}
+
+	return v.validateRuntimeEnvironment(ctx, r)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *customRuntimeEnvironmentValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	r, ok := newObj.(*CustomRuntimeEnvironment)
+	if !ok {
+		return fmt.Errorf("expected a CustomRuntimeEnvironment but got a %T", newObj)
+	}
+
+	if err := r.ValidateUpdate(oldObj); err != nil {
+		return err
+	}
+	if !r.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	// a secret may have been deleted since, only a changed gitSecret is checked again
+	old := oldObj.(*CustomRuntimeEnvironment)
+	if !equality.Semantic.DeepEqual(old.Spec.GitSecret, r.Spec.GitSecret) {
+		if err := v.validateGitSecret(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	// a catalog entry may have been removed since, only a changed runtimeEnvironment is checked again
+	if equality.Semantic.DeepEqual(old.Spec.RuntimeEnvironment, r.Spec.RuntimeEnvironment) && old.Spec.BaseImage == r.Spec.BaseImage {
+		return nil
+	}
+
+	return v.validateRuntimeEnvironment(ctx, r)
+}
+
+// validateRuntimeEnvironment checks that the runtimeEnvironment of a build on a base image without a baseImage
+// is listed in a RuntimeEnvironmentCatalog
+func (v *customRuntimeEnvironmentValidator) validateRuntimeEnvironment(ctx context.Context, r *CustomRuntimeEnvironment) error {
+	if !r.Spec.BuildType.BuildsOnBaseImage() || r.Spec.BaseImage != "" {
+		return nil
+	}
+
+	catalogs := &RuntimeEnvironmentCatalogList{}
+	if err := v.client.List(ctx, catalogs); err != nil {
+		return err
+	}
+
+	if _, ok := catalogs.ResolveBaseImage(r.Spec.RuntimeEnvironment); ok {
+		return nil
+	}
+
+	path := field.NewPath("spec.runtimeEnvironment")
+	runtimeEnvironment := describeRuntimeEnvironment(r.Spec.RuntimeEnvironment.OSName, r.Spec.RuntimeEnvironment.OSVersion, r.Spec.RuntimeEnvironment.PythonVersion)
+	supported := catalogs.SupportedRuntimeEnvironments()
+
+	var fieldErr *field.Error
+	if len(supported) == 0 {
+		fieldErr = field.Invalid(path, runtimeEnvironment, "no RuntimeEnvironmentCatalog lists any runtime environment, set a baseImage instead")
+	} else {
+		fieldErr = field.NotSupported(path, runtimeEnvironment, supported)
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: Group, Kind: "CustomRuntimeEnvironment"},
+		r.Name, field.ErrorList{fieldErr})
+}
+
+// validateGitSecret checks that the gitSecret exists in the namespace of the CustomRuntimeEnvironment, and is of
+// a type the builds know how to clone with
+func (v *customRuntimeEnvironmentValidator) validateGitSecret(ctx context.Context, r *CustomRuntimeEnvironment) error {
+	if r.Spec.GitSecret == nil {
+		return nil
+	}
+
+	path := field.NewPath("spec.gitSecret.name")
+	secret := &corev1.Secret{}
+	var fieldErr *field.Error
+	if err := v.client.Get(ctx, client.ObjectKey{Namespace: r.Namespace, Name: r.Spec.GitSecret.Name}, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		fieldErr = field.NotFound(path, r.Spec.GitSecret.Name)
+	} else if !IsGitSecretType(secret.Type) {
+		fieldErr = field.Invalid(path, r.Spec.GitSecret.Name, fmt.Sprintf("secret is of type %s, not %s or %s", secret.Type, corev1.SecretTypeSSHAuth, corev1.SecretTypeBasicAuth))
+	}
+	if fieldErr == nil {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: Group, Kind: "CustomRuntimeEnvironment"},
+		r.Name, field.ErrorList{fieldErr})
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *customRuntimeEnvironmentValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*CustomRuntimeEnvironment)
+	if !ok {
+		return fmt.Errorf("expected a CustomRuntimeEnvironment but got a %T", obj)
+	}
+
+	if err := r.ValidateDelete(); err != nil {
+		return err
+	}
+
+	if _, ok := r.Annotations[CREForceDeleteAnnotationKey]; ok {
+		customruntimeenvironmentlog.Info("deleting regardless of references", "name", r.Name)
+		return nil
+	}
+
+	users, err := v.imageUsers(ctx, r)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	return apierrors.NewForbidden(
+		schema.GroupResource{Group: Group, Resource: "customruntimeenvironments"}, r.Name,
+		fmt.Errorf("its image is in use by %s, set the %s annotation to delete it anyway", strings.Join(users, ", "), CREForceDeleteAnnotationKey))
+}
+
+// imageUsers returns the running Pods of the namespace and the other CustomRuntimeEnvironments using the image of the
+// CustomRuntimeEnvironment. The notebooks run in the namespace of the CustomRuntimeEnvironment providing their image.
+func (v *customRuntimeEnvironmentValidator) imageUsers(ctx context.Context, r *CustomRuntimeEnvironment) ([]string, error) {
+	users := []string{}
+	if r.Status.Image == nil {
+		return users, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := v.client.List(ctx, pods, client.InNamespace(r.Namespace)); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if podUsesImage(&pod, r) {
+			users = append(users, fmt.Sprintf("Pod %s/%s", pod.Namespace, pod.Name))
+		}
+	}
+
+	cres := &CustomRuntimeEnvironmentList{}
+	if err := v.client.List(ctx, cres); err != nil {
+		return nil, err
+	}
+	for _, cre := range cres.Items {
+		if cre.Namespace == r.Namespace && cre.Name == r.Name {
+			continue
+		}
+		if r.refersToImage(cre.Spec.BaseImage) {
+			users = append(users, fmt.Sprintf("CustomRuntimeEnvironment %s/%s", cre.Namespace, cre.Name))
+		}
+	}
+
+	return users, nil
+}
+
+// podUsesImage returns true if any of the containers of the Pod runs the image of the CustomRuntimeEnvironment
+func podUsesImage(pod *corev1.Pod, r *CustomRuntimeEnvironment) bool {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if r.refersToImage(container.Image) {
+			return true
+		}
+	}
+
+	// the image may have been pulled by a tag which has moved since, the digest identifies it
+	if r.Status.Image.Digest != "" {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if strings.HasSuffix(status.ImageID, "@"+r.Status.Image.Digest) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // ValidateCustomRuntimeEnvironment implements webhook.Validator for create/update
 func (r *CustomRuntimeEnvironment) ValidateCustomRuntimeEnvironment() error {
-	var allErrs field.ErrorList
+	allErrs := r.validateCustomRuntimeEnvironmentAnnotations()
 
-	if err := r.validateCustomRuntimeEnvironmentAnnotation(CRENameAnnotationKey); err != nil {
-		allErrs = append(allErrs, err)
+	switch r.Spec.BuildType {
+	case PackageList:
+		if err := r.validateCustomRuntimeEnvironmentPackageListBuildType(); err != nil {
+			allErrs = append(allErrs, err)
+		}
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentPackageVersions()...)
+	case ImportImage:
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentImportImageBuildType()...)
+	case GitRepository:
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentGitRepositoryBuildType()...)
+	case CondaEnvironment:
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentCondaEnvironmentBuildType()...)
+	case Pipenv:
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentPipenvBuildType()...)
+	case Containerfile:
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentContainerfileBuildType()...)
 	}
-	if err := r.validateCustomRuntimeEnvironmentAnnotation(CREDescriptionAnnotationKey); err != nil {
-		allErrs = append(allErrs, err)
+
+	allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentBuildTypeFields()...)
+
+	// the Job build backend has no equivalent of the tasks generating a JupyterHub image from a repository
+	if r.Spec.BuildBackend == JobBuildBackend && r.Spec.BuildType == GitRepository {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.buildBackend"), "GitRepository builds are not supported by the Job build backend"))
 	}
-	if err := r.validateCustomRuntimeEnvironmentAnnotation(CRECreatorAnnotationKey); err != nil {
-		allErrs = append(allErrs, err)
+	// nor does it record the pinned requirements a Locked rebuild reuses
+	if r.Spec.BuildBackend == JobBuildBackend && r.Spec.LockMode == Locked {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.lockMode"), "Locked builds are not supported by the Job build backend"))
 	}
 
-	if r.Spec.BuildType == PackageList {
-		if err := r.validateCustomRuntimeEnvironmentPackageListBuildType(); err != nil {
+	if r.Spec.BaseImage != "" {
+		if err := validateImageReference(field.NewPath("spec.baseImage"), r.Spec.BaseImage); err != nil {
 			allErrs = append(allErrs, err)
 		}
 	}
 
+	allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentWorkspace()...)
+
+	if !r.Spec.hasValidImagePullSecret() {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec.imagePullSecret.name"), "name is required"))
+	}
+
+	if timeout := r.Spec.BuildTimeout; timeout != nil && timeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec.buildTimeout"), timeout.Duration.String(), "must be positive"))
+	}
+
+	if r.Spec.RebuildSchedule != "" {
+		if _, err := ParseSchedule(r.Spec.RebuildSchedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.rebuildSchedule"), r.Spec.RebuildSchedule, err.Error()))
+		}
+	}
+
+	if policy := r.Spec.RetryPolicy; policy != nil && policy.Backoff != nil && policy.Backoff.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec.retryPolicy.backoff"), policy.Backoff.Duration.String(), "must not be negative"))
+	}
+
+	if r.Spec.GitSecret != nil {
+		path := field.NewPath("spec.gitSecret")
+		switch {
+		case r.Spec.GitSecret.Name == "":
+			allErrs = append(allErrs, field.Required(path.Child("name"), "name is required"))
+		case r.Spec.Repository == "":
+			allErrs = append(allErrs, field.Forbidden(path, "a gitSecret requires a repository"))
+		}
+	}
+
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -104,6 +503,23 @@ func (r *CustomRuntimeEnvironment) ValidateCustomRuntimeEnvironment() error {
 		r.Name, allErrs)
 }
 
+// validateCustomRuntimeEnvironmentAnnotations checks that the annotations describing the image are set
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentAnnotations() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if err := r.validateCustomRuntimeEnvironmentAnnotation(CRENameAnnotationKey); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateCustomRuntimeEnvironmentAnnotation(CREDescriptionAnnotationKey); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateCustomRuntimeEnvironmentAnnotation(CRECreatorAnnotationKey); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	return allErrs
+}
+
 func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentAnnotation(annotation string) *field.Error {
 	if r.Annotations == nil {
 		return field.Required(field.NewPath("metadata.annotations"), "annotation is required")
@@ -127,6 +543,12 @@ func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentPackageListBu
 		return field.Required(field.NewPath("spec.packageVersions"), "packageVersions is required")
 	}
 
+	return r.validateCustomRuntimeEnvironmentBaseImage()
+}
+
+// validateCustomRuntimeEnvironmentBaseImage checks that exactly one of baseImage and runtimeEnvironment is given
+// for the build types building on a base image
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentBaseImage() *field.Error {
 	if (r.Spec.BaseImage != "") && r.Spec.RuntimeEnvironment.isValid() {
 		return field.Invalid(field.NewPath("spec.baseImage"), r.Spec.BaseImage, "baseImage and runtimeEnvironment are mutually exclusive")
 	}
@@ -137,3 +559,272 @@ func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentPackageListBu
 
 	return nil
 }
+
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentCondaEnvironmentBuildType() field.ErrorList {
+	allErrs := validateFileSource(field.NewPath("spec.environmentFile"), "environmentFile", r.Spec.EnvironmentFile, true, validateCondaEnvironmentFile)
+
+	if err := r.validateCustomRuntimeEnvironmentBaseImage(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	return allErrs
+}
+
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentPipenvBuildType() field.ErrorList {
+	allErrs := validateFileSource(field.NewPath("spec.pipfile"), "pipfile", r.Spec.Pipfile, true, validatePipfile)
+	allErrs = append(allErrs, validateFileSource(field.NewPath("spec.pipfileLock"), "pipfileLock", r.Spec.PipfileLock, false, validatePipfileLock)...)
+
+	if err := r.validateCustomRuntimeEnvironmentBaseImage(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	return allErrs
+}
+
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentContainerfileBuildType() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.Repository == "" {
+		if r.Spec.Containerfile == nil {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec.containerfile"), "containerfile or repository is required"))
+		}
+		if r.Spec.ContextDir != "" {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.contextDir"), "contextDir requires a repository"))
+		}
+		if r.Spec.ContainerfilePath != "" {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.containerfilePath"), "containerfilePath requires a repository"))
+		}
+		if r.Spec.GitRef != "" {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec.gitRef"), "gitRef requires a repository"))
+		}
+	} else {
+		allErrs = append(allErrs, r.validateCustomRuntimeEnvironmentGitRepositoryBuildType()...)
+
+		if r.Spec.Containerfile != nil && r.Spec.ContainerfilePath != "" {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.containerfilePath"), r.Spec.ContainerfilePath, "containerfilePath and containerfile are mutually exclusive"))
+		}
+		if err := validateRelativePath(field.NewPath("spec.contextDir"), r.Spec.ContextDir); err != nil {
+			allErrs = append(allErrs, err)
+		}
+		if err := validateRelativePath(field.NewPath("spec.containerfilePath"), r.Spec.ContainerfilePath); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	allErrs = append(allErrs, validateFileSource(field.NewPath("spec.containerfile"), "containerfile", r.Spec.Containerfile, false, validateContainerfile)...)
+
+	return allErrs
+}
+
+// validateRelativePath checks that the path stays within the Repository
+func validateRelativePath(fieldPath *field.Path, p string) *field.Error {
+	if path.IsAbs(p) {
+		return field.Invalid(fieldPath, p, "must be a relative path")
+	}
+	for _, element := range strings.Split(p, "/") {
+		if element == ".." {
+			return field.Invalid(fieldPath, p, "must not contain '..'")
+		}
+	}
+
+	return nil
+}
+
+// validateFileSource checks that a file is given either inline or by a ConfigMap reference, the inline content is
+// checked by validateContent, the content of a ConfigMap is only available to the build
+func validateFileSource(path *field.Path, name string, source *FileSource, required bool, validateContent func(string) error) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if source == nil {
+		if required {
+			allErrs = append(allErrs, field.Required(path, fmt.Sprintf("%s is required", name)))
+		}
+		return allErrs
+	}
+
+	switch {
+	case source.Content != "" && source.ConfigMapKeyRef != nil:
+		allErrs = append(allErrs, field.Forbidden(path.Child("configMapKeyRef"), "content and configMapKeyRef are mutually exclusive"))
+	case source.Content != "":
+		if err := validateContent(source.Content); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("content"), source.Content, err.Error()))
+		}
+	case source.ConfigMapKeyRef != nil:
+		if source.ConfigMapKeyRef.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("configMapKeyRef", "name"), "name is required"))
+		}
+		if source.ConfigMapKeyRef.Key == "" {
+			allErrs = append(allErrs, field.Required(path.Child("configMapKeyRef", "key"), "key is required"))
+		}
+	default:
+		allErrs = append(allErrs, field.Required(path, "content or configMapKeyRef is required"))
+	}
+
+	return allErrs
+}
+
+// validateCustomRuntimeEnvironmentPackageVersions checks that each of packageVersions is a PEP 508 requirement,
+// and that no package is required twice
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentPackageVersions() field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, packageVersion := range r.Spec.PackageVersions {
+		path := field.NewPath("spec.packageVersions").Index(i)
+
+		requirement, err := parseRequirement(packageVersion)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path, packageVersion, err.Error()))
+			continue
+		}
+
+		normalized := normalizePackageName(requirement.name)
+		if seen[normalized] {
+			allErrs = append(allErrs, field.Invalid(path, packageVersion, fmt.Sprintf("package %q is required more than once", normalized)))
+			continue
+		}
+		seen[normalized] = true
+	}
+
+	return allErrs
+}
+
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentImportImageBuildType() field.ErrorList {
+	if r.Spec.FromImage == "" {
+		return field.ErrorList{field.Required(field.NewPath("spec.fromImage"), "fromImage is required")}
+	}
+
+	if err := validateImageReference(field.NewPath("spec.fromImage"), r.Spec.FromImage); err != nil {
+		return field.ErrorList{err}
+	}
+
+	return nil
+}
+
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentGitRepositoryBuildType() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.Repository == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec.repository"), "repository is required"))
+	} else if err := validateGitRepositoryURL(r.Spec.Repository); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec.repository"), r.Spec.Repository, err.Error()))
+	}
+
+	if r.Spec.GitRef != "" {
+		if err := validateGitRef(r.Spec.GitRef); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec.gitRef"), r.Spec.GitRef, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateCustomRuntimeEnvironmentBuildTypeFields rejects the fields which are not used by the buildType
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentBuildTypeFields() field.ErrorList {
+	var allErrs field.ErrorList
+
+	forbidden := func(path string, set bool) {
+		if set {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath(path), fmt.Sprintf("not supported by buildType %s", r.Spec.BuildType)))
+		}
+	}
+
+	buildType := r.Spec.BuildType
+	forbidden("spec.fromImage", buildType != ImportImage && r.Spec.FromImage != "")
+	forbidden("spec.baseImage", !buildType.BuildsOnBaseImage() && r.Spec.BaseImage != "")
+	forbidden("spec.runtimeEnvironment", !buildType.BuildsOnBaseImage() && r.Spec.RuntimeEnvironment != CustomRuntimeEnvironmentRuntimeSpec{})
+	forbidden("spec.packageVersions", buildType != PackageList && len(r.Spec.PackageVersions) > 0)
+	forbidden("spec.lockMode", buildType != PackageList && r.Spec.LockMode != "")
+	forbidden("spec.repository", buildType != GitRepository && buildType != Containerfile && r.Spec.Repository != "")
+	forbidden("spec.gitRef", buildType != GitRepository && buildType != Containerfile && r.Spec.GitRef != "")
+	forbidden("spec.gitSecret", buildType != GitRepository && buildType != Containerfile && r.Spec.GitSecret != nil)
+	forbidden("spec.imagePullSecret", (buildType == GitRepository || buildType == Containerfile) && r.Spec.ImagePullSecret != ImagePullSecret{})
+	forbidden("spec.contextDir", buildType != Containerfile && r.Spec.ContextDir != "")
+	forbidden("spec.containerfilePath", buildType != Containerfile && r.Spec.ContainerfilePath != "")
+	forbidden("spec.containerfile", buildType != Containerfile && r.Spec.Containerfile != nil)
+	forbidden("spec.environmentFile", buildType != CondaEnvironment && r.Spec.EnvironmentFile != nil)
+	forbidden("spec.pipfile", buildType != Pipenv && r.Spec.Pipfile != nil)
+	forbidden("spec.pipfileLock", buildType != Pipenv && r.Spec.PipfileLock != nil)
+
+	return allErrs
+}
+
+// validateCustomRuntimeEnvironmentWorkspace checks that the workspace either uses an existing claim or describes the
+// claims created per build, and that the CA bundle names its ConfigMap and key
+func (r *CustomRuntimeEnvironment) validateCustomRuntimeEnvironmentWorkspace() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if workspace := r.Spec.Workspace; workspace != nil {
+		path := field.NewPath("spec.workspace")
+		if workspace.ClaimName != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(workspace.ClaimName) {
+				allErrs = append(allErrs, field.Invalid(path.Child("claimName"), workspace.ClaimName, msg))
+			}
+			if !equality.Semantic.DeepEqual(workspace.VolumeClaimTemplate, corev1.PersistentVolumeClaimSpec{}) {
+				allErrs = append(allErrs, field.Forbidden(path.Child("volumeClaimTemplate"), "volumeClaimTemplate and claimName are mutually exclusive"))
+			}
+		}
+	}
+
+	if caBundle := r.Spec.CABundle; caBundle != nil {
+		path := field.NewPath("spec.caBundle")
+		if caBundle.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "name is required"))
+		}
+		if caBundle.Key == "" {
+			allErrs = append(allErrs, field.Required(path.Child("key"), "key is required"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateImageReference checks that the image is a container image reference, optionally including a tag or digest
+func validateImageReference(path *field.Path, image string) *field.Error {
+	if _, err := name.ParseReference(image); err != nil {
+		return field.Invalid(path, image, err.Error())
+	}
+
+	return nil
+}
+
+// validateGitRepositoryURL checks that the repository is an https or ssh URL, including the scp-like syntax of ssh
+func validateGitRepositoryURL(repository string) error {
+	if scpLikeGitURLRegexp.MatchString(repository) {
+		return nil
+	}
+
+	u, err := url.Parse(repository)
+	if err != nil {
+		return fmt.Errorf("must be a git URL: %s", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "ssh" {
+		return fmt.Errorf("must be an https or ssh URL")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("must include a host")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("must include the path of the repository")
+	}
+	if _, ok := u.User.Password(); ok {
+		return fmt.Errorf("must not include a password")
+	}
+
+	return nil
+}
+
+// validateGitRef checks that the gitRef is a valid git reference, see git-check-ref-format(1)
+func validateGitRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("must not start with '-'")
+	}
+	if strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.HasSuffix(ref, ".lock") {
+		return fmt.Errorf("must not contain '..' or '@{', nor end with '.lock'")
+	}
+	if strings.IndexFunc(ref, func(c rune) bool { return c <= ' ' || c == 0x7f || strings.ContainsRune("~^:?*[\\", c) }) >= 0 {
+		return fmt.Errorf("must not contain whitespace, control characters or any of '~^:?*[\\'")
+	}
+
+	return nil
+}
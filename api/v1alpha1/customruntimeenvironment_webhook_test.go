@@ -18,11 +18,15 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 )
 
 var _ = Describe("CustomRuntimeEnvironment Webhook", func() {
@@ -83,7 +87,58 @@ var _ = Describe("CustomRuntimeEnvironment Webhook", func() {
 
 			err := k8sClient.Create(context.Background(), cre)
 			Expect(err).ShouldNot(Succeed())
-			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-3\" is invalid: [metadata.annotations[opendatahub.io/notebook-image-desc]: Required value: annotation is required, metadata.annotations[opendatahub.io/notebook-image-creator]: Required value: annotation is required]"))
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-3\" is invalid: metadata.annotations[opendatahub.io/notebook-image-desc]: Required value: annotation is required"))
+		})
+		It("should default the name and creator annotations", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-11", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   build,
+					PackageVersions: packageVersions,
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			Expect(cre.Annotations).Should(HaveKeyWithValue(CRENameAnnotationKey, "webhook-11"))
+			Expect(cre.Annotations).Should(HaveKeyWithValue(CRECreatorAnnotationKey, Not(BeEmpty())))
+		})
+		It("should not override the name and creator annotations", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-12", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   build,
+					PackageVersions: packageVersions,
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRENameAnnotationKey, "Webhook 12")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			Expect(cre.Annotations).Should(HaveKeyWithValue(CRENameAnnotationKey, "Webhook 12"))
+			Expect(cre.Annotations).Should(HaveKeyWithValue(CRECreatorAnnotationKey, "ginkgo+gomega"))
+		})
+		It("should default the gitRef of a GitRepository build", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-13", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "https://github.com/thoth-station/elyra-aidevsecops-tutorial",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			Expect(cre.Spec.GitRef).Should(Equal(DefaultGitRef))
 		})
 
 	})
@@ -154,6 +209,48 @@ var _ = Describe("CustomRuntimeEnvironment Webhook", func() {
 
 		})
 
+		It("should fail if runtimeEnvironment is not listed in a RuntimeEnvironmentCatalog", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-33", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   packageListRuntimeEnvironment,
+					PackageVersions: packageVersions,
+					RuntimeEnvironment: CustomRuntimeEnvironmentRuntimeSpec{
+						PythonVersion: "3.6",
+						OSName:        "fedora",
+						OSVersion:     "35",
+					},
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-33\" is invalid: spec.runtimeEnvironment: Unsupported value: \"fedora 35 with Python 3.6\": supported values: \"ubi 8 with Python 3.6\", \"ubi 8 with Python 3.8\""))
+		})
+
+		It("should fail if runtimeEnvironment is changed to one not listed in a RuntimeEnvironmentCatalog", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-34", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:      packageListRuntimeEnvironment,
+					PackageVersions:    packageVersions,
+					RuntimeEnvironment: runtimeEnvironment,
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			cre.Spec.RuntimeEnvironment.PythonVersion = "3.10"
+			err := k8sClient.Update(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-34\" is invalid: spec.runtimeEnvironment: Unsupported value: \"ubi 8 with Python 3.10\": supported values: \"ubi 8 with Python 3.6\", \"ubi 8 with Python 3.8\""))
+		})
+
 		It("should pass if baseImage is present", func() {
 			cre := &CustomRuntimeEnvironment{
 				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
@@ -193,5 +290,715 @@ var _ = Describe("CustomRuntimeEnvironment Webhook", func() {
 			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-7\" is invalid: spec.baseImage: Invalid value: \"quay.io/thoth-station/s2i-custom-notebook:latest\": baseImage and runtimeEnvironment are mutually exclusive"))
 
 		})
+
+		It("should fail if a packageVersion is not a PEP 508 requirement", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-8", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   packageListBaseImage,
+					PackageVersions: []string{"pandas>>1.0", "boto3"},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRENameAnnotationKey, "webhook-8")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-8\" is invalid: spec.packageVersions[0]: Invalid value: \"pandas>>1.0\": invalid version specifier \">>1.0\""))
+
+		})
+
+		It("should fail if a package is required twice", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-9", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   packageListBaseImage,
+					PackageVersions: []string{"scikit-learn", "Scikit_Learn>=1.0"},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRENameAnnotationKey, "webhook-9")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-9\" is invalid: spec.packageVersions[1]: Invalid value: \"scikit-learn>=1.0\": package \"scikit-learn\" is required more than once"))
+
+		})
+
+		It("should normalize package names", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-10", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   packageListBaseImage,
+					PackageVersions: []string{"Scikit_Learn[alldeps]>=1.0; python_version >= '3.8'"},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRENameAnnotationKey, "webhook-10")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			Expect(cre.Spec.PackageVersions).Should(Equal([]string{"scikit-learn[alldeps]>=1.0; python_version >= '3.8'"}))
+
+		})
+	})
+	Context("when a CustomRuntimeEnvironment object is created with a buildType of ImageImport", func() {
+		It("should pass if fromImage is a pinned image reference", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-14", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+						FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if fromImage is missing", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-15", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+						FromImage: "",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-15\" is invalid: spec.fromImage: Required value: fromImage is required"))
+		})
+
+		It("should fail if fromImage is not an image reference", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-16", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+						FromImage: "quay.io/thoth-station/s2i minimal",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-16\" is invalid: spec.fromImage: Invalid value: \"quay.io/thoth-station/s2i minimal\": could not parse reference: quay.io/thoth-station/s2i minimal"))
+		})
+
+		It("should fail if packageVersions are present", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-17", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: ImportImage,
+						FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+					},
+					PackageVersions: []string{"pandas"},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-17\" is invalid: spec.packageVersions: Forbidden: not supported by buildType ImageImport"))
+		})
+	})
+	Context("when a CustomRuntimeEnvironment object is created with a buildType of GitRepository", func() {
+		It("should pass if repository is an ssh URL", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-18", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "git@github.com:AICoE/elyra-aidevsecops-tutorial.git",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if repository is missing", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-19", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-19\" is invalid: spec.repository: Required value: repository is required"))
+		})
+
+		It("should fail if repository is not an https or ssh URL", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-20", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "http://github.com/AICoE/elyra-aidevsecops-tutorial",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-20\" is invalid: spec.repository: Invalid value: \"http://github.com/AICoE/elyra-aidevsecops-tutorial\": must be an https or ssh URL"))
+		})
+
+		It("should fail if baseImage is present", func() {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-21", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType:  GitRepository,
+						Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+						BaseImage:  "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+					},
+				},
+				Status: CustomRuntimeEnvironmentStatus{},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-21\" is invalid: spec.baseImage: Forbidden: not supported by buildType GitRepository"))
+		})
+	})
+	Context("when a CustomRuntimeEnvironment object is created with a buildType of CondaEnvironment or Pipenv", func() {
+		newCRE := func(name string, build BuildTypeSpec) *CustomRuntimeEnvironment {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: build,
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+			return cre
+		}
+
+		It("should pass if the environmentFile is given inline", func() {
+			cre := newCRE("webhook-35", BuildTypeSpec{
+				BuildType:       CondaEnvironment,
+				BaseImage:       "quay.io/jupyter/minimal-notebook:latest",
+				EnvironmentFile: &FileSource{Content: "dependencies:\n  - pandas\n"},
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if the environmentFile has no dependencies", func() {
+			cre := newCRE("webhook-36", BuildTypeSpec{
+				BuildType:       CondaEnvironment,
+				BaseImage:       "quay.io/jupyter/minimal-notebook:latest",
+				EnvironmentFile: &FileSource{Content: "name: base\n"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-36\" is invalid: spec.environmentFile.content: Invalid value: \"name: base\\n\": the Conda environment has no dependencies"))
+		})
+
+		It("should pass if the pipfile and pipfileLock are given by ConfigMap references", func() {
+			cre := newCRE("webhook-37", BuildTypeSpec{
+				BuildType:   Pipenv,
+				BaseImage:   "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+				Pipfile:     &FileSource{ConfigMapKeyRef: &ConfigMapKeyReference{Name: "webhook-37", Key: "Pipfile"}},
+				PipfileLock: &FileSource{ConfigMapKeyRef: &ConfigMapKeyReference{Name: "webhook-37", Key: "Pipfile.lock"}},
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if the pipfile is missing", func() {
+			cre := newCRE("webhook-38", BuildTypeSpec{
+				BuildType: Pipenv,
+				BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-38\" is invalid: spec.pipfile: Required value: pipfile is required"))
+		})
+
+		It("should fail if the pipfile is given inline and by a ConfigMap reference", func() {
+			cre := newCRE("webhook-39", BuildTypeSpec{
+				BuildType: Pipenv,
+				BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+				Pipfile: &FileSource{
+					Content:         "[packages]\npandas = \"*\"\n",
+					ConfigMapKeyRef: &ConfigMapKeyReference{Name: "webhook-39", Key: "Pipfile"},
+				},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-39\" is invalid: spec.pipfile.configMapKeyRef: Forbidden: content and configMapKeyRef are mutually exclusive"))
+		})
+
+		It("should fail if an environmentFile is given for a Pipenv build", func() {
+			cre := newCRE("webhook-40", BuildTypeSpec{
+				BuildType:       Pipenv,
+				BaseImage:       "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+				Pipfile:         &FileSource{Content: "[packages]\npandas = \"*\"\n"},
+				EnvironmentFile: &FileSource{Content: "dependencies:\n  - pandas\n"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-40\" is invalid: spec.environmentFile: Forbidden: not supported by buildType Pipenv"))
+		})
+	})
+
+	Context("when a CustomRuntimeEnvironment object is created with a buildType of Containerfile", func() {
+		newCRE := func(name string, build BuildTypeSpec) *CustomRuntimeEnvironment {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: build,
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+			return cre
+		}
+
+		It("should default the gitRef and containerfilePath of a repository", func() {
+			cre := newCRE("webhook-41", BuildTypeSpec{
+				BuildType:  Containerfile,
+				Repository: "https://github.com/thoth-station/s2i-custom-notebook",
+				ContextDir: "cuda",
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			Expect(cre.Spec.GitRef).Should(Equal(DefaultGitRef))
+			Expect(cre.Spec.ContainerfilePath).Should(Equal(DefaultContainerfilePath))
+		})
+
+		It("should pass if the containerfile is given inline", func() {
+			cre := newCRE("webhook-42", BuildTypeSpec{
+				BuildType:     Containerfile,
+				Containerfile: &FileSource{Content: "FROM quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2\nRUN pip install graphviz\n"},
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if neither repository nor containerfile is present", func() {
+			cre := newCRE("webhook-43", BuildTypeSpec{
+				BuildType: Containerfile,
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-43\" is invalid: spec.containerfile: Required value: containerfile or repository is required"))
+		})
+
+		It("should fail if the contextDir leaves the repository", func() {
+			cre := newCRE("webhook-44", BuildTypeSpec{
+				BuildType:  Containerfile,
+				Repository: "https://github.com/thoth-station/s2i-custom-notebook",
+				ContextDir: "../etc",
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-44\" is invalid: spec.contextDir: Invalid value: \"../etc\": must not contain '..'"))
+		})
+
+		It("should fail if the containerfile does not start with FROM", func() {
+			cre := newCRE("webhook-45", BuildTypeSpec{
+				BuildType:     Containerfile,
+				Containerfile: &FileSource{Content: "RUN pip install graphviz"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-45\" is invalid: spec.containerfile.content: Invalid value: \"RUN pip install graphviz\": the Containerfile has to start with a FROM instruction, not RUN"))
+		})
+
+		It("should fail if a GitRepository is built by the Job build backend", func() {
+			cre := newCRE("webhook-46", BuildTypeSpec{
+				BuildType:  GitRepository,
+				Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+			})
+			cre.Spec.BuildBackend = JobBuildBackend
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-46\" is invalid: spec.buildBackend: Forbidden: GitRepository builds are not supported by the Job build backend"))
+		})
+
+		It("should succeed if a Containerfile is built by the Job build backend", func() {
+			cre := newCRE("webhook-47", BuildTypeSpec{
+				BuildType:     Containerfile,
+				Containerfile: &FileSource{Content: "FROM quay.io/thoth-station/s2i-custom-notebook:latest"},
+			})
+			cre.Spec.BuildBackend = JobBuildBackend
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if a Locked PackageList is built by the Job build backend", func() {
+			cre := newCRE("webhook-60", BuildTypeSpec{
+				BuildType: PackageList,
+				BaseImage: "quay.io/thoth-station/s2i-custom-notebook:latest",
+			})
+			cre.Spec.PackageVersions = []string{"pandas"}
+			cre.Spec.LockMode = Locked
+			cre.Spec.BuildBackend = JobBuildBackend
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-60\" is invalid: spec.lockMode: Forbidden: Locked builds are not supported by the Job build backend"))
+		})
+
+		It("should fail if the workspace sets a claim and a claim template", func() {
+			cre := newCRE("webhook-48", BuildTypeSpec{
+				BuildType: ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			})
+			cre.Spec.Workspace = &WorkspaceSpec{
+				ClaimName:           "cre-builds",
+				VolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{StorageClassName: pointer.String("fast")},
+			}
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-48\" is invalid: spec.workspace.volumeClaimTemplate: Forbidden: volumeClaimTemplate and claimName are mutually exclusive"))
+		})
+
+		It("should fail if the CA bundle has no key", func() {
+			cre := newCRE("webhook-49", BuildTypeSpec{
+				BuildType: ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			})
+			cre.Spec.CABundle = &ConfigMapKeyReference{Name: "trusted-ca"}
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-49\" is invalid: spec.caBundle.key: Required value: key is required"))
+		})
+
+		It("should fail if the gitSecret does not exist", func() {
+			cre := newCRE("webhook-50", BuildTypeSpec{
+				BuildType:  GitRepository,
+				Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+				GitSecret:  &GitSecret{Name: "webhook-50-git"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-50\" is invalid: spec.gitSecret.name: Not found: \"webhook-50-git\""))
+		})
+
+		It("should fail if the gitSecret is not of a git secret type", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-51-git", Namespace: "default"},
+				StringData: map[string]string{"token": "secret"},
+			}
+			Expect(k8sClient.Create(context.Background(), secret)).Should(Succeed())
+
+			cre := newCRE("webhook-51", BuildTypeSpec{
+				BuildType:  GitRepository,
+				Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+				GitSecret:  &GitSecret{Name: "webhook-51-git"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-51\" is invalid: spec.gitSecret.name: Invalid value: \"webhook-51-git\": secret is of type Opaque, not kubernetes.io/ssh-auth or kubernetes.io/basic-auth"))
+		})
+
+		It("should succeed if the gitSecret is a basic-auth secret", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-52-git", Namespace: "default"},
+				Type:       corev1.SecretTypeBasicAuth,
+				StringData: map[string]string{corev1.BasicAuthUsernameKey: "ginkgo", corev1.BasicAuthPasswordKey: "gomega"},
+			}
+			Expect(k8sClient.Create(context.Background(), secret)).Should(Succeed())
+
+			cre := newCRE("webhook-52", BuildTypeSpec{
+				BuildType:  Containerfile,
+				Repository: "https://github.com/thoth-station/s2i-custom-notebook",
+				GitSecret:  &GitSecret{Name: "webhook-52-git"},
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if a gitSecret is set without a repository", func() {
+			cre := newCRE("webhook-53", BuildTypeSpec{
+				BuildType:     Containerfile,
+				Containerfile: &FileSource{Content: "FROM quay.io/thoth-station/s2i-custom-notebook:latest"},
+				GitSecret:     &GitSecret{Name: "webhook-52-git"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-53\" is invalid: spec.gitSecret: Forbidden: a gitSecret requires a repository"))
+		})
+
+		It("should succeed if an imported image is pulled with an imagePullSecret which does not exist yet", func() {
+			cre := newCRE("webhook-54", BuildTypeSpec{
+				BuildType:       ImportImage,
+				FromImage:       "quay.io/goern/private-s2i-minimal-py38-notebook:v0.2.2",
+				ImagePullSecret: ImagePullSecret{Name: "private-registry-credentials"},
+			})
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if a Containerfile build sets an imagePullSecret", func() {
+			cre := newCRE("webhook-55", BuildTypeSpec{
+				BuildType:       Containerfile,
+				Containerfile:   &FileSource{Content: "FROM quay.io/goern/private-s2i-minimal-py38-notebook:v0.2.2"},
+				ImagePullSecret: ImagePullSecret{Name: "private-registry-credentials"},
+			})
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-55\" is invalid: spec.imagePullSecret: Forbidden: not supported by buildType Containerfile"))
+		})
+
+		It("should fail if the retry policy has a negative backoff", func() {
+			cre := newCRE("webhook-56", BuildTypeSpec{
+				BuildType: ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			})
+			cre.Spec.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: &metav1.Duration{Duration: -time.Minute}}
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-56\" is invalid: spec.retryPolicy.backoff: Invalid value: \"-1m0s\": must not be negative"))
+		})
+
+		It("should fail if the build timeout is zero", func() {
+			cre := newCRE("webhook-57", BuildTypeSpec{
+				BuildType: ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			})
+			cre.Spec.BuildTimeout = &metav1.Duration{}
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-57\" is invalid: spec.buildTimeout: Invalid value: \"0s\": must be positive"))
+		})
+
+		It("should fail if the rebuild schedule is not in cron syntax", func() {
+			cre := newCRE("webhook-58", BuildTypeSpec{
+				BuildType: ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			})
+			cre.Spec.RebuildSchedule = "0 3 * *"
+			err := k8sClient.Create(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-58\" is invalid: spec.rebuildSchedule: Invalid value: \"0 3 * *\": expected 5 fields, found 4"))
+		})
+	})
+
+	Context("when a CustomRuntimeEnvironment object is updated", func() {
+		newCRE := func(name string) *CustomRuntimeEnvironment {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+						BaseImage: "quay.io/thoth-station/s2i-custom-notebook:latest",
+					},
+					PackageVersions: []string{"pandas"},
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+			return cre
+		}
+
+		It("should fail if buildType is changed", func() {
+			cre := newCRE("webhook-22")
+			cre.Spec.BuildTypeSpec = BuildTypeSpec{
+				BuildType:  GitRepository,
+				Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+			}
+			cre.Spec.PackageVersions = nil
+
+			err := k8sClient.Update(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-22\" is invalid: spec.buildType: Forbidden: buildType is immutable"))
+		})
+
+		It("should fail if the creator annotation is changed", func() {
+			cre := newCRE("webhook-23")
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CRECreatorAnnotationKey, "someone-else")
+
+			err := k8sClient.Update(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-23\" is invalid: metadata.annotations[opendatahub.io/notebook-image-creator]: Forbidden: annotation is immutable"))
+		})
+
+		It("should fail if the spec is changed while a build is running", func() {
+			cre := newCRE("webhook-24")
+			cre.Status.Phase = PhaseRunning
+			Expect(k8sClient.Status().Update(context.Background(), cre)).Should(Succeed())
+
+			cre.Spec.PackageVersions = []string{"pandas", "boto3"}
+			err := k8sClient.Update(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: CustomRuntimeEnvironment.meteor.zone \"webhook-24\" is invalid: spec: Forbidden: spec cannot be changed while a build is running, unless the meteor.zone/force-rebuild annotation is set"))
+		})
+
+		It("should pass if the spec is changed while a build is running with the force-rebuild annotation", func() {
+			cre := newCRE("webhook-25")
+			cre.Status.Phase = PhaseRunning
+			Expect(k8sClient.Status().Update(context.Background(), cre)).Should(Succeed())
+
+			cre.Spec.PackageVersions = []string{"pandas", "boto3"}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREForceRebuildAnnotationKey, "")
+			Expect(k8sClient.Update(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should pass if only the metadata is changed while a build is running", func() {
+			cre := newCRE("webhook-26")
+			cre.Status.Phase = PhaseRunning
+			Expect(k8sClient.Status().Update(context.Background(), cre)).Should(Succeed())
+
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "updated")
+			Expect(k8sClient.Update(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should not validate an unchanged spec again", func() {
+			old := &CustomRuntimeEnvironment{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-61", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{BuildType: PackageList, BaseImage: "not a valid image reference"},
+				},
+			}
+			metav1.SetMetaDataAnnotation(&old.ObjectMeta, CRENameAnnotationKey, "webhook-61")
+			metav1.SetMetaDataAnnotation(&old.ObjectMeta, CREDescriptionAnnotationKey, "default")
+			metav1.SetMetaDataAnnotation(&old.ObjectMeta, CRECreatorAnnotationKey, "ginkgo+gomega")
+			Expect(old.ValidateCreate()).ShouldNot(Succeed())
+
+			cre := old.DeepCopy()
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "updated")
+			Expect(cre.ValidateUpdate(old)).Should(Succeed())
+
+			delete(cre.Annotations, CREDescriptionAnnotationKey)
+			Expect(cre.ValidateUpdate(old)).ShouldNot(Succeed())
+		})
+
+		It("should not validate the spec of a CustomRuntimeEnvironment being deleted", func() {
+			old := &CustomRuntimeEnvironment{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-62", Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec:   BuildTypeSpec{BuildType: PackageList, BaseImage: "not a valid image reference"},
+					PackageVersions: []string{"pandas"},
+				},
+			}
+			now := metav1.Now()
+			old.DeletionTimestamp = &now
+
+			cre := old.DeepCopy()
+			cre.Spec.PackageVersions = []string{"pandas", "boto3"}
+			Expect(cre.ValidateUpdate(old)).Should(Succeed())
+		})
+	})
+	Context("when a CustomRuntimeEnvironment object is deleted", func() {
+		digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		newCRE := func(name, baseImage string) *CustomRuntimeEnvironment {
+			cre := &CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: BuildTypeSpec{
+						BuildType: PackageList,
+						BaseImage: baseImage,
+					},
+					PackageVersions: []string{"pandas"},
+				},
+			}
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREDescriptionAnnotationKey, "default")
+
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			cre.Status.Image = &ImageStatus{
+				PullSpec: fmt.Sprintf("quay.io/thoth-station/%s:latest", name),
+				Digest:   digest,
+			}
+			Expect(k8sClient.Status().Update(context.Background(), cre)).Should(Succeed())
+			return cre
+		}
+
+		It("should pass if its image is not in use", func() {
+			cre := newCRE("webhook-27", "quay.io/thoth-station/s2i-custom-notebook:latest")
+
+			Expect(k8sClient.Delete(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should fail if its image is the baseImage of another CustomRuntimeEnvironment", func() {
+			cre := newCRE("webhook-28", "quay.io/thoth-station/s2i-custom-notebook:latest")
+			newCRE("webhook-29", "quay.io/thoth-station/webhook-28:latest")
+
+			err := k8sClient.Delete(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: customruntimeenvironments.meteor.zone \"webhook-28\" is forbidden: its image is in use by CustomRuntimeEnvironment default/webhook-29, set the meteor.zone/force-delete annotation to delete it anyway"))
+		})
+
+		It("should fail if its image is used by a Pod", func() {
+			cre := newCRE("webhook-30", "quay.io/thoth-station/s2i-custom-notebook:latest")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-30-notebook", Namespace: "default"},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "notebook", Image: "quay.io/thoth-station/webhook-30@" + digest}},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), pod)).Should(Succeed())
+
+			err := k8sClient.Delete(context.Background(), cre)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err).Should(MatchError("admission webhook \"vcustomruntimeenvironment.kb.io\" denied the request: customruntimeenvironments.meteor.zone \"webhook-30\" is forbidden: its image is in use by Pod default/webhook-30-notebook, set the meteor.zone/force-delete annotation to delete it anyway"))
+		})
+
+		It("should pass if its image is only used by a Pod of another namespace", func() {
+			cre := newCRE("webhook-59", "quay.io/thoth-station/s2i-custom-notebook:latest")
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "webhook-59"}}
+			Expect(k8sClient.Create(context.Background(), namespace)).Should(Succeed())
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook-59-notebook", Namespace: namespace.Name},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "notebook", Image: "quay.io/thoth-station/webhook-59@" + digest}},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), pod)).Should(Succeed())
+
+			Expect(k8sClient.Delete(context.Background(), cre)).Should(Succeed())
+		})
+
+		It("should pass if its image is in use but the force-delete annotation is set", func() {
+			cre := newCRE("webhook-31", "quay.io/thoth-station/s2i-custom-notebook:latest")
+			newCRE("webhook-32", "quay.io/thoth-station/webhook-31:latest")
+
+			metav1.SetMetaDataAnnotation(&cre.ObjectMeta, CREForceDeleteAnnotationKey, "")
+			Expect(k8sClient.Update(context.Background(), cre)).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), cre)).Should(Succeed())
+		})
 	})
 })
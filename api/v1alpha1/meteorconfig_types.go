@@ -32,6 +32,140 @@ type MeteorConfigSpec struct {
 
 	// EnableShower is the feature flar/config to enable Shower
 	EnableShower bool `json:"enableComa,omitempty"`
+
+	// CustomRuntimeEnvironment is the operator-level configuration of CustomRuntimeEnvironments
+	CustomRuntimeEnvironment CustomRuntimeEnvironmentConfig `json:"customRuntimeEnvironment,omitempty"`
+}
+
+// CustomRuntimeEnvironmentConfig is the operator-level configuration of CustomRuntimeEnvironments
+type CustomRuntimeEnvironmentConfig struct {
+	// DefaultRuntimeEnvironment is used for the fields of the runtimeEnvironment a PackageList build does not set,
+	// unless it uses a baseImage
+	// +optional
+	DefaultRuntimeEnvironment CustomRuntimeEnvironmentRuntimeSpec `json:"defaultRuntimeEnvironment,omitempty"`
+
+	// BuildBackend is used for the builds of CustomRuntimeEnvironments which do not select one, defaults to Tekton
+	// +optional
+	BuildBackend BuildBackend `json:"buildBackend,omitempty"`
+
+	// JobBuildBackend configures the builds run as Kubernetes Jobs
+	// +optional
+	JobBuildBackend JobBuildBackendConfig `json:"jobBuildBackend,omitempty"`
+
+	// Workspace configures the volume the builds work in, unless a CustomRuntimeEnvironment overrides it
+	// +optional
+	Workspace WorkspaceSpec `json:"workspace,omitempty"`
+
+	// CABundle is the ConfigMap key holding the CA certificates the builds trust, unless a CustomRuntimeEnvironment
+	// overrides it. The ConfigMap has to exist in the namespaces of the CustomRuntimeEnvironments, defaults to the
+	// OpenShift service CA.
+	// +optional
+	CABundle *ConfigMapKeyReference `json:"caBundle,omitempty"`
+
+	// BuildTimeout is the time a build may take, unless a CustomRuntimeEnvironment overrides it. Defaults to 1h.
+	// +optional
+	BuildTimeout *metav1.Duration `json:"buildTimeout,omitempty"`
+
+	// BuildPendingTimeout is the time a build may wait for its first step to start, e.g. for its workspace to be
+	// bound or its images to be pulled, before it is cancelled and fails. Defaults to 10m.
+	// +optional
+	BuildPendingTimeout *metav1.Duration `json:"buildPendingTimeout,omitempty"`
+
+	// Concurrency limits the number of builds running at the same time, the builds over the limits are queued
+	// +optional
+	Concurrency BuildConcurrencyConfig `json:"concurrency,omitempty"`
+
+	// Pipelines customizes the Tekton Pipelines running the builds, by build type
+	// +optional
+	Pipelines map[BuildType]PipelineConfig `json:"pipelines,omitempty"`
+}
+
+// QueueOrder is the order in which queued builds are started
+// +kubebuilder:validation:Enum=FIFO;Priority
+type QueueOrder string
+
+// orders of the build queue
+const (
+	// FIFOQueueOrder starts the builds in the order they were queued
+	FIFOQueueOrder QueueOrder = "FIFO"
+	// PriorityQueueOrder starts the builds of the highest priority first, and the ones of the same priority in
+	// the order they were queued
+	PriorityQueueOrder QueueOrder = "Priority"
+)
+
+// BuildConcurrencyConfig limits the number of builds of CustomRuntimeEnvironments running at the same time
+type BuildConcurrencyConfig struct {
+	// MaxBuilds is the number of builds running at the same time in the cluster, unlimited if not set
+	// +optional
+	MaxBuilds int32 `json:"maxBuilds,omitempty"`
+
+	// MaxBuildsPerNamespace is the number of builds running at the same time in a namespace, unlimited if not set
+	// +optional
+	MaxBuildsPerNamespace int32 `json:"maxBuildsPerNamespace,omitempty"`
+
+	// QueueOrder is the order in which the queued builds are started, defaults to FIFO
+	// +optional
+	QueueOrder QueueOrder `json:"queueOrder,omitempty"`
+}
+
+// PipelineConfig customizes the Tekton Pipeline running the builds of a build type
+type PipelineConfig struct {
+	// PipelineRef references the Pipeline, defaults to the cre-<pipeline> Pipeline shipped with the operator
+	// +optional
+	PipelineRef *PipelineReference `json:"pipelineRef,omitempty"`
+
+	// Params are added to the parameters of the builds, replacing the ones of the same name. Their values are
+	// Go templates evaluated against the CustomRuntimeEnvironment, e.g. "{{ .Spec.Repository }}", the
+	// parameters the operator passes by default are available as e.g. "{{ .Params.baseImage }}".
+	// +optional
+	Params []ParamTemplate `json:"params,omitempty"`
+}
+
+// PipelineReference references a Tekton Pipeline by name, by Tekton bundle or through a Tekton resolver
+type PipelineReference struct {
+	// Name of the Pipeline
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the Pipeline, the Pipelines of other namespaces than the one of the CustomRuntimeEnvironment
+	// are fetched by the Tekton cluster resolver
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Bundle is the reference of the Tekton bundle containing the Pipeline
+	// +optional
+	Bundle string `json:"bundle,omitempty"`
+
+	// Resolver is the Tekton resolver fetching the Pipeline, e.g. git or hub
+	// +optional
+	Resolver string `json:"resolver,omitempty"`
+
+	// ResolverParams are the parameters of the Resolver identifying the Pipeline
+	// +optional
+	ResolverParams map[string]string `json:"resolverParams,omitempty"`
+}
+
+// ParamTemplate is a parameter of a Pipeline whose value is a Go template
+type ParamTemplate struct {
+	// Name of the parameter
+	// +required
+	Name string `json:"name"`
+
+	// Value is the Go template of the value of the parameter
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// JobBuildBackendConfig is the configuration of the builds run as Kubernetes Jobs
+type JobBuildBackendConfig struct {
+	// BuilderImage is the buildah image running the builds
+	// +optional
+	BuilderImage string `json:"builderImage,omitempty"`
+
+	// Registry is the registry the built images are pushed to, as <registry>/<namespace>/<build>:latest.
+	// Defaults to the OpenShift internal registry on OpenShift, required on other clusters.
+	// +optional
+	Registry string `json:"registry,omitempty"`
 }
 
 //+kubebuilder:object:root=true
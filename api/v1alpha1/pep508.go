@@ -0,0 +1,349 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// packageNameRegexp matches package names and extras, see https://peps.python.org/pep-0508/#names
+	packageNameRegexp = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+	// packageNameSeparatorRegexp matches the runs of separators replaced by PEP 503 normalization
+	packageNameSeparatorRegexp = regexp.MustCompile(`[-_.]+`)
+
+	// versionSpecifierRegexp matches a single version specifier, e.g. ">=1.24.0"
+	versionSpecifierRegexp = regexp.MustCompile(`^(~=|===|==|!=|<=|>=|<|>)\s*(\S+)$`)
+
+	// versionRegexp matches public and local versions, see https://peps.python.org/pep-0440/#appendix-b-parsing-version-strings-with-regular-expressions
+	versionRegexp = regexp.MustCompile(`^(?i)v?([0-9]+!)?[0-9]+(\.[0-9]+)*([-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?[0-9]*)?(-[0-9]+|[-_.]?(post|rev|r)[-_.]?[0-9]*)?([-_.]?dev[-_.]?[0-9]*)?(\+[a-z0-9]+([-_.][a-z0-9]+)*)?$`)
+
+	// markerVariables are the environment marker variables, see https://peps.python.org/pep-0508/#environment-markers
+	markerVariables = map[string]bool{
+		"python_version":                 true,
+		"python_full_version":            true,
+		"os_name":                        true,
+		"sys_platform":                   true,
+		"platform_release":               true,
+		"platform_system":                true,
+		"platform_version":               true,
+		"platform_machine":               true,
+		"platform_python_implementation": true,
+		"implementation_name":            true,
+		"implementation_version":         true,
+		"extra":                          true,
+	}
+
+	// markerOperators are the comparison operators allowed in environment markers, besides 'in' and 'not in'
+	markerOperators = map[string]bool{
+		"<": true, "<=": true, "!=": true, "==": true, ">=": true, ">": true, "~=": true, "===": true,
+	}
+)
+
+// requirement is a Python package requirement as specified by PEP 508, e.g. "boto3[crt]>=1.24.0; python_version>='3.8'"
+type requirement struct {
+	// name is the name of the package, as written
+	name string
+	// extras are the optional features of the package requested
+	extras []string
+	// specifiers are the version specifiers, e.g. ">=1.24.0"
+	specifiers []string
+	// url is the location of the package for URL requirements
+	url string
+	// marker is the environment marker restricting where the requirement applies
+	marker string
+}
+
+// normalizePackageName returns the PEP 503 normalized form of a package name
+func normalizePackageName(name string) string {
+	return strings.ToLower(packageNameSeparatorRegexp.ReplaceAllString(name, "-"))
+}
+
+// parseRequirement parses a PEP 508 requirement specifier
+func parseRequirement(input string) (*requirement, error) {
+	p := &requirementParser{input: strings.TrimSpace(input)}
+	if p.input == "" {
+		return nil, fmt.Errorf("requirement must not be empty")
+	}
+
+	r := &requirement{name: p.takeWhile(isNameChar)}
+	if !packageNameRegexp.MatchString(r.name) {
+		return nil, fmt.Errorf("invalid package name %q", r.name)
+	}
+
+	p.skipSpace()
+	if p.consume("[") {
+		extras := p.takeWhile(func(c byte) bool { return c != ']' })
+		if !p.consume("]") {
+			return nil, fmt.Errorf("missing closing ']' of extras")
+		}
+		for _, extra := range strings.Split(extras, ",") {
+			extra = strings.TrimSpace(extra)
+			if extra == "" && strings.TrimSpace(extras) == "" {
+				continue
+			}
+			if !packageNameRegexp.MatchString(extra) {
+				return nil, fmt.Errorf("invalid extra %q", extra)
+			}
+			r.extras = append(r.extras, extra)
+		}
+	}
+
+	p.skipSpace()
+	if p.consume("@") {
+		p.skipSpace()
+		r.url = p.takeWhile(func(c byte) bool { return !isSpace(c) })
+		if u, err := url.Parse(r.url); err != nil || u.Scheme == "" {
+			return nil, fmt.Errorf("invalid URL %q", r.url)
+		}
+	} else {
+		var versions string
+		if p.consume("(") {
+			versions = p.takeWhile(func(c byte) bool { return c != ')' })
+			if !p.consume(")") {
+				return nil, fmt.Errorf("missing closing ')' of version specifiers")
+			}
+		} else {
+			versions = p.takeWhile(func(c byte) bool { return c != ';' })
+		}
+		if strings.TrimSpace(versions) != "" {
+			for _, specifier := range strings.Split(versions, ",") {
+				specifier = strings.TrimSpace(specifier)
+				if err := validateVersionSpecifier(specifier); err != nil {
+					return nil, err
+				}
+				r.specifiers = append(r.specifiers, specifier)
+			}
+		}
+	}
+
+	p.skipSpace()
+	if p.consume(";") {
+		r.marker = strings.TrimSpace(p.input[p.pos:])
+		if err := validateMarker(r.marker); err != nil {
+			return nil, err
+		}
+		p.pos = len(p.input)
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return r, nil
+}
+
+// validateVersionSpecifier checks a single version specifier such as ">=1.24.0" or "==1.*"
+func validateVersionSpecifier(specifier string) error {
+	match := versionSpecifierRegexp.FindStringSubmatch(specifier)
+	if match == nil {
+		return fmt.Errorf("invalid version specifier %q", specifier)
+	}
+
+	operator, version := match[1], match[2]
+	switch {
+	case operator == "===":
+		// arbitrary equality matches any string
+		return nil
+	case (operator == "==" || operator == "!=") && strings.HasSuffix(version, ".*"):
+		version = strings.TrimSuffix(version, ".*")
+	}
+
+	if !versionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid version specifier %q", specifier)
+	}
+
+	return nil
+}
+
+// validateMarker checks an environment marker such as "python_version >= '3.8' and sys_platform == 'linux'"
+func validateMarker(marker string) error {
+	tokens, err := tokenizeMarker(marker)
+	if err != nil {
+		return fmt.Errorf("invalid environment marker %q: %s", marker, err)
+	}
+
+	p := &markerParser{tokens: tokens}
+	if err := p.parseOr(); err != nil {
+		return fmt.Errorf("invalid environment marker %q: %s", marker, err)
+	}
+	if p.pos != len(p.tokens) {
+		return fmt.Errorf("invalid environment marker %q: unexpected %q", marker, p.tokens[p.pos])
+	}
+
+	return nil
+}
+
+// tokenizeMarker splits an environment marker into parentheses, quoted strings, operators and identifiers
+func tokenizeMarker(marker string) ([]string, error) {
+	tokens := []string{}
+	p := &requirementParser{input: marker}
+
+	for p.skipSpace(); !p.done(); p.skipSpace() {
+		c := p.input[p.pos]
+		switch {
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			p.pos++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(p.input[p.pos+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, p.input[p.pos:p.pos+end+2])
+			p.pos += end + 2
+		case strings.IndexByte("<>=!~", c) >= 0:
+			operator := p.takeWhile(func(c byte) bool { return strings.IndexByte("<>=!~", c) >= 0 })
+			if !markerOperators[operator] {
+				return nil, fmt.Errorf("invalid operator %q", operator)
+			}
+			tokens = append(tokens, operator)
+		case isNameChar(c):
+			tokens = append(tokens, p.takeWhile(isNameChar))
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+// requirementParser is a cursor over the input of a requirement or an environment marker
+type requirementParser struct {
+	input string
+	pos   int
+}
+
+func (p *requirementParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *requirementParser) skipSpace() {
+	p.takeWhile(isSpace)
+}
+
+func (p *requirementParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.input[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *requirementParser) takeWhile(accept func(byte) bool) string {
+	start := p.pos
+	for !p.done() && accept(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// markerParser is a recursive descent parser of the marker grammar of PEP 508
+type markerParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *markerParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *markerParser) parseOr() error {
+	if err := p.parseAnd(); err != nil {
+		return err
+	}
+	for p.next() == "or" {
+		p.pos++
+		if err := p.parseAnd(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *markerParser) parseAnd() error {
+	if err := p.parseExpression(); err != nil {
+		return err
+	}
+	for p.next() == "and" {
+		p.pos++
+		if err := p.parseExpression(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *markerParser) parseExpression() error {
+	if p.next() == "(" {
+		p.pos++
+		if err := p.parseOr(); err != nil {
+			return err
+		}
+		if p.next() != ")" {
+			return fmt.Errorf("missing closing ')'")
+		}
+		p.pos++
+		return nil
+	}
+
+	if err := p.parseVariable(); err != nil {
+		return err
+	}
+	switch operator := p.next(); {
+	case markerOperators[operator] || operator == "in":
+		p.pos++
+	case operator == "not":
+		p.pos++
+		if p.next() != "in" {
+			return fmt.Errorf("expected 'in' after 'not'")
+		}
+		p.pos++
+	default:
+		return fmt.Errorf("expected an operator, got %q", operator)
+	}
+	return p.parseVariable()
+}
+
+func (p *markerParser) parseVariable() error {
+	variable := p.next()
+	if variable == "" {
+		return fmt.Errorf("unexpected end of marker")
+	}
+	if !markerVariables[variable] && variable[0] != '\'' && variable[0] != '"' {
+		return fmt.Errorf("unknown marker variable %q", variable)
+	}
+	p.pos++
+	return nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
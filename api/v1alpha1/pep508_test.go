@@ -0,0 +1,110 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseRequirement tests parsing of PEP 508 requirements
+func TestParseRequirement(t *testing.T) {
+	testCases := map[string]struct {
+		input          string
+		expectedOutput *requirement
+	}{
+		"name": {
+			input:          "pandas",
+			expectedOutput: &requirement{name: "pandas"},
+		},
+		"version": {
+			input:          "pandas==1.4.3",
+			expectedOutput: &requirement{name: "pandas", specifiers: []string{"==1.4.3"}},
+		},
+		"versions": {
+			input:          "numpy >=1.21, <2.0.0rc1",
+			expectedOutput: &requirement{name: "numpy", specifiers: []string{">=1.21", "<2.0.0rc1"}},
+		},
+		"parenthesized-versions": {
+			input:          "numpy (>=1.21,!=1.22.*)",
+			expectedOutput: &requirement{name: "numpy", specifiers: []string{">=1.21", "!=1.22.*"}},
+		},
+		"extras": {
+			input:          "boto3[crt, s3]~=1.24",
+			expectedOutput: &requirement{name: "boto3", extras: []string{"crt", "s3"}, specifiers: []string{"~=1.24"}},
+		},
+		"marker": {
+			input:          "tensorflow>=2.9; python_version >= '3.8' and (sys_platform == 'linux' or platform_machine not in 'arm64')",
+			expectedOutput: &requirement{name: "tensorflow", specifiers: []string{">=2.9"}, marker: "python_version >= '3.8' and (sys_platform == 'linux' or platform_machine not in 'arm64')"},
+		},
+		"url": {
+			input:          "pip @ https://github.com/pypa/pip/archive/22.2.zip ; python_version >= '3.7'",
+			expectedOutput: &requirement{name: "pip", url: "https://github.com/pypa/pip/archive/22.2.zip", marker: "python_version >= '3.7'"},
+		},
+		"arbitrary-equality": {
+			input:          "foobar===custom-build",
+			expectedOutput: &requirement{name: "foobar", specifiers: []string{"===custom-build"}},
+		},
+		"empty":                   {input: ""},
+		"invalid-name":            {input: "-pandas"},
+		"invalid-operator":        {input: "pandas>>1.0"},
+		"invalid-version":         {input: "pandas==one"},
+		"wildcard-not-allowed":    {input: "pandas>=1.*"},
+		"missing-operator":        {input: "pandas 1.0"},
+		"unclosed-extras":         {input: "boto3[crt"},
+		"invalid-url":             {input: "pip @ github.com/pypa/pip"},
+		"unknown-marker-variable": {input: "pandas; python == '3.8'"},
+		"incomplete-marker":       {input: "pandas; python_version >="},
+		"unterminated-marker":     {input: "pandas; python_version >= '3.8"},
+	}
+
+	for tcName, tc := range testCases {
+		output, err := parseRequirement(tc.input)
+		if tc.expectedOutput == nil {
+			if err == nil {
+				t.Errorf("%s Got %v while expecting an error", tcName, output)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s Got error %s while expecting %v", tcName, err, tc.expectedOutput)
+			continue
+		}
+		if !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestNormalizePackageName tests PEP 503 normalization of package names
+func TestNormalizePackageName(t *testing.T) {
+	testCases := map[string]struct {
+		input          string
+		expectedOutput string
+	}{
+		"lower":      {input: "pandas", expectedOutput: "pandas"},
+		"upper":      {input: "Django", expectedOutput: "django"},
+		"underscore": {input: "Scikit_Learn", expectedOutput: "scikit-learn"},
+		"runs":       {input: "zope.-_interface", expectedOutput: "zope-interface"},
+	}
+
+	for tcName, tc := range testCases {
+		if output := normalizePackageName(tc.input); output != tc.expectedOutput {
+			t.Errorf("%s Got %s while expecting %s", tcName, output, tc.expectedOutput)
+		}
+	}
+}
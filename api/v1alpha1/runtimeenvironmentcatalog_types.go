@@ -0,0 +1,121 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatalogRuntimeEnvironment is a runtime environment supported for building Custom Runtime Environments
+type CatalogRuntimeEnvironment struct {
+	// PythonVersion is the version of Python provided by the base image
+	// +required
+	PythonVersion string `json:"pythonVersion"`
+	// OSName is the Name of the Operating System of the base image
+	// +required
+	OSName string `json:"osName"`
+	// OSVersion is the Version of the Operating System of the base image
+	// +required
+	OSVersion string `json:"osVersion"`
+	// BaseImage is the reference to the image PackageList builds for this runtime environment are based on
+	// +required
+	BaseImage string `json:"baseImage"`
+}
+
+// matches returns true if the catalog entry provides the runtime environment
+func (e *CatalogRuntimeEnvironment) matches(runtime CustomRuntimeEnvironmentRuntimeSpec) bool {
+	return strings.EqualFold(e.OSName, runtime.OSName) &&
+		e.OSVersion == runtime.OSVersion &&
+		e.PythonVersion == runtime.PythonVersion
+}
+
+// RuntimeEnvironmentCatalogSpec defines the desired state of RuntimeEnvironmentCatalog
+type RuntimeEnvironmentCatalogSpec struct {
+	// RuntimeEnvironments are the supported combinations of operating system and Python version, with their base images
+	// +optional
+	RuntimeEnvironments []CatalogRuntimeEnvironment `json:"runtimeEnvironments,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// RuntimeEnvironmentCatalog lists the runtime environments Custom Runtime Environments can be built for
+type RuntimeEnvironmentCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RuntimeEnvironmentCatalogSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RuntimeEnvironmentCatalogList contains a list of RuntimeEnvironmentCatalog
+type RuntimeEnvironmentCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RuntimeEnvironmentCatalog `json:"items"`
+}
+
+// ResolveBaseImage returns the base image of the first catalog entry providing the runtime environment,
+// catalogs are searched in the order of their names
+func (l *RuntimeEnvironmentCatalogList) ResolveBaseImage(runtime CustomRuntimeEnvironmentRuntimeSpec) (string, bool) {
+	catalogs := append([]RuntimeEnvironmentCatalog{}, l.Items...)
+	sort.Slice(catalogs, func(i, j int) bool { return catalogs[i].Name < catalogs[j].Name })
+
+	for _, catalog := range catalogs {
+		for _, entry := range catalog.Spec.RuntimeEnvironments {
+			if entry.matches(runtime) {
+				return entry.BaseImage, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// SupportedRuntimeEnvironments returns the descriptions of all runtime environments listed in the catalogs, sorted
+func (l *RuntimeEnvironmentCatalogList) SupportedRuntimeEnvironments() []string {
+	seen := map[string]bool{}
+	supported := []string{}
+	for _, catalog := range l.Items {
+		for _, entry := range catalog.Spec.RuntimeEnvironments {
+			description := describeRuntimeEnvironment(entry.OSName, entry.OSVersion, entry.PythonVersion)
+			if !seen[description] {
+				seen[description] = true
+				supported = append(supported, description)
+			}
+		}
+	}
+	sort.Strings(supported)
+
+	return supported
+}
+
+// describeRuntimeEnvironment returns a human readable description of a runtime environment, e.g. "ubi 8 with Python 3.8"
+func describeRuntimeEnvironment(osName, osVersion, pythonVersion string) string {
+	return fmt.Sprintf("%s %s with Python %s", osName, osVersion, pythonVersion)
+}
+
+func init() {
+	SchemeBuilder.Register(&RuntimeEnvironmentCatalog{}, &RuntimeEnvironmentCatalogList{})
+}
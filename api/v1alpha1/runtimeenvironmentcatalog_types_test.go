@@ -0,0 +1,113 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestSupportedRuntimeEnvironments tests if the runtime environments of all catalogs are listed once
+func TestSupportedRuntimeEnvironments(t *testing.T) {
+	catalogs := RuntimeEnvironmentCatalogList{
+		Items: []RuntimeEnvironmentCatalog{
+			{
+				Spec: RuntimeEnvironmentCatalogSpec{
+					RuntimeEnvironments: []CatalogRuntimeEnvironment{
+						{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8", BaseImage: "quay.io/example/custom-py38:latest"},
+						{OSName: "fedora", OSVersion: "35", PythonVersion: "3.10", BaseImage: "quay.io/example/fedora-py310:latest"},
+					},
+				},
+			},
+			{
+				Spec: RuntimeEnvironmentCatalogSpec{
+					RuntimeEnvironments: []CatalogRuntimeEnvironment{
+						{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8", BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+					},
+				},
+			},
+		},
+	}
+	expectedOutput := []string{"fedora 35 with Python 3.10", "ubi 8 with Python 3.8"}
+
+	if output := catalogs.SupportedRuntimeEnvironments(); !reflect.DeepEqual(output, expectedOutput) {
+		t.Errorf("Got %v while expecting %v", output, expectedOutput)
+	}
+	if output := (&RuntimeEnvironmentCatalogList{}).SupportedRuntimeEnvironments(); len(output) != 0 {
+		t.Errorf("empty Got %v while expecting none", output)
+	}
+}
+
+// TestResolveBaseImage tests if a runtime environment is resolved to the base image of the first matching catalog entry
+func TestResolveBaseImage(t *testing.T) {
+	catalogs := RuntimeEnvironmentCatalogList{
+		Items: []RuntimeEnvironmentCatalog{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "zz-custom"},
+				Spec: RuntimeEnvironmentCatalogSpec{
+					RuntimeEnvironments: []CatalogRuntimeEnvironment{
+						{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8", BaseImage: "quay.io/example/custom-py38:latest"},
+						{OSName: "fedora", OSVersion: "35", PythonVersion: "3.10", BaseImage: "quay.io/example/fedora-py310:latest"},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "default"},
+				Spec: RuntimeEnvironmentCatalogSpec{
+					RuntimeEnvironments: []CatalogRuntimeEnvironment{
+						{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8", BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+						{OSName: "ubi", OSVersion: "8", PythonVersion: "3.6", BaseImage: "quay.io/thoth-station/s2i-custom-notebook:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		runtime        CustomRuntimeEnvironmentRuntimeSpec
+		expectedOutput string
+		expectedFound  bool
+	}{
+		"first-catalog-by-name": {
+			runtime:        CustomRuntimeEnvironmentRuntimeSpec{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8"},
+			expectedOutput: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+			expectedFound:  true,
+		},
+		"os-name-case-insensitive": {
+			runtime:        CustomRuntimeEnvironmentRuntimeSpec{OSName: "UBI", OSVersion: "8", PythonVersion: "3.6"},
+			expectedOutput: "quay.io/thoth-station/s2i-custom-notebook:latest",
+			expectedFound:  true,
+		},
+		"other-catalog": {
+			runtime:        CustomRuntimeEnvironmentRuntimeSpec{OSName: "fedora", OSVersion: "35", PythonVersion: "3.10"},
+			expectedOutput: "quay.io/example/fedora-py310:latest",
+			expectedFound:  true,
+		},
+		"no-match": {
+			runtime: CustomRuntimeEnvironmentRuntimeSpec{OSName: "ubi", OSVersion: "9", PythonVersion: "3.9"},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		output, found := catalogs.ResolveBaseImage(tc.runtime)
+		if output != tc.expectedOutput || found != tc.expectedFound {
+			t.Errorf("%s Got %s (%t) while expecting %s (%t)", tcName, output, found, tc.expectedOutput, tc.expectedFound)
+		}
+	}
+}
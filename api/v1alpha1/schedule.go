@@ -0,0 +1,219 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// scheduleMacros are the predefined schedules, see crontab(5)
+	scheduleMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+
+	// scheduleFields are the fields of a schedule, in the order they are written
+	scheduleFields = []scheduleField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: map[string]int{
+			"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+			"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+		}},
+		// 7 is Sunday as well
+		{name: "day of week", min: 0, max: 7, names: map[string]int{
+			"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+		}},
+	}
+)
+
+// scheduleSearchLimit is how far ahead the next time of a schedule is searched, schedules like "0 0 30 2 *" never run
+const scheduleSearchLimit = 5 * 366 * 24 * time.Hour
+
+// scheduleField describes the values a field of a schedule may take
+type scheduleField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+// Schedule is a cron schedule, e.g. "0 3 * * 0" for every Sunday at 03:00 UTC
+// +kubebuilder:object:generate=false
+type Schedule struct {
+	// minute, hour, dayOfMonth, month and dayOfWeek are the sets of values the fields match, as bit sets
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// anyDayOfMonth and anyDayOfWeek tell if the day fields were written as "*", a day matches if both day fields
+	// match it when either of them is, and if any of them matches otherwise, see crontab(5)
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// ParseSchedule parses a schedule in cron syntax: the five fields minute, hour, day of month, month and day of week,
+// each a list of values, ranges and steps, e.g. "0 3 * * sun" or "*/30 8-18 * * 1-5", or one of the macros @yearly,
+// @monthly, @weekly, @daily and @hourly. Schedules are evaluated in UTC.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := scheduleMacros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown schedule %q", spec)
+		}
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("expected %d fields, found %d", len(scheduleFields), len(fields))
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := parseScheduleField(f, scheduleFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return &Schedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dayOfMonth:    sets[2],
+		month:         sets[3],
+		dayOfWeek:     sets[4],
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}, nil
+}
+
+// parseScheduleField parses a comma-separated list of values, ranges and steps of a field, e.g. "1,15" or "8-18/2"
+func parseScheduleField(value string, field scheduleField) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(value, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q of %s", stepExpr, field.name)
+			}
+		}
+
+		var low, high int
+		switch first, last, isRange := strings.Cut(rangeExpr, "-"); {
+		case rangeExpr == "*":
+			low, high = field.min, field.max
+		case isRange:
+			var err error
+			if low, err = parseScheduleValue(first, field); err != nil {
+				return 0, err
+			}
+			if high, err = parseScheduleValue(last, field); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q of %s", rangeExpr, field.name)
+			}
+		default:
+			var err error
+			if low, err = parseScheduleValue(rangeExpr, field); err != nil {
+				return 0, err
+			}
+			high = low
+			// a step after a single value runs from the value to the end of the field, e.g. "5/15"
+			if hasStep {
+				high = field.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+// parseScheduleValue parses a single number or name of a field
+func parseScheduleValue(value string, field scheduleField) (int, error) {
+	if v, ok := field.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", field.name, value)
+	}
+	if v < field.min || v > field.max {
+		return 0, fmt.Errorf("%s %d out of range %d-%d", field.name, v, field.min, field.max)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after t the schedule runs at, in UTC, or the zero time if it never runs
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(scheduleSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchesDay returns true if the schedule runs on the day of t
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseSchedule tests parsing of cron schedules
+func TestParseSchedule(t *testing.T) {
+	testCases := map[string]struct {
+		input         string
+		expectedError bool
+	}{
+		"weekly":              {input: "0 3 * * 0"},
+		"macro":               {input: "@weekly"},
+		"names":               {input: "30 2 * jan-jun sun,Sat"},
+		"steps":               {input: "*/15 8-18/2 1,15 * *"},
+		"sunday-as-7":         {input: "0 0 * * 7"},
+		"too-few-fields":      {input: "0 3 * *", expectedError: true},
+		"too-many-fields":     {input: "0 0 3 * * 0", expectedError: true},
+		"unknown-macro":       {input: "@fortnightly", expectedError: true},
+		"out-of-range":        {input: "60 * * * *", expectedError: true},
+		"invalid-range":       {input: "0 18-8 * * *", expectedError: true},
+		"invalid-step":        {input: "*/0 * * * *", expectedError: true},
+		"invalid-name":        {input: "0 0 * * sunday", expectedError: true},
+		"empty":               {input: "", expectedError: true},
+		"day-of-month-zero":   {input: "0 0 0 * *", expectedError: true},
+		"seconds-not-allowed": {input: "0 0 3 * * *", expectedError: true},
+	}
+
+	for tcName, tc := range testCases {
+		_, err := ParseSchedule(tc.input)
+		if tc.expectedError && err == nil {
+			t.Errorf("%s Got no error while expecting one", tcName)
+		}
+		if !tc.expectedError && err != nil {
+			t.Errorf("%s Got error %v while expecting none", tcName, err)
+		}
+	}
+}
+
+// TestScheduleNext tests if the next time a schedule runs at is found
+func TestScheduleNext(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2022, time.August, 17, 10, 20, 30, 0, time.UTC)
+
+	testCases := map[string]struct {
+		schedule       string
+		now            time.Time
+		expectedOutput time.Time
+	}{
+		"hourly": {
+			schedule:       "@hourly",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 17, 11, 0, 0, 0, time.UTC),
+		},
+		"every-minute": {
+			schedule:       "* * * * *",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 17, 10, 21, 0, 0, time.UTC),
+		},
+		"strictly-after": {
+			schedule:       "20 10 * * *",
+			now:            time.Date(2022, time.August, 17, 10, 20, 0, 0, time.UTC),
+			expectedOutput: time.Date(2022, time.August, 18, 10, 20, 0, 0, time.UTC),
+		},
+		"weekly": {
+			schedule:       "0 3 * * sun",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 21, 3, 0, 0, 0, time.UTC),
+		},
+		"sunday-as-7": {
+			schedule:       "0 3 * * 7",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 21, 3, 0, 0, 0, time.UTC),
+		},
+		"monthly": {
+			schedule:       "@monthly",
+			now:            now,
+			expectedOutput: time.Date(2022, time.September, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"next-year": {
+			schedule:       "0 0 1 feb *",
+			now:            now,
+			expectedOutput: time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"day-of-month-or-week": {
+			schedule:       "0 0 1 * mon",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 22, 0, 0, 0, 0, time.UTC),
+		},
+		"steps": {
+			schedule:       "*/15 */6 * * *",
+			now:            now,
+			expectedOutput: time.Date(2022, time.August, 17, 12, 0, 0, 0, time.UTC),
+		},
+		"leap-day": {
+			schedule:       "0 0 29 2 *",
+			now:            now,
+			expectedOutput: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"never": {
+			schedule:       "0 0 30 2 *",
+			now:            now,
+			expectedOutput: time.Time{},
+		},
+		"other-time-zone": {
+			schedule:       "0 12 * * *",
+			now:            time.Date(2022, time.August, 17, 13, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			expectedOutput: time.Date(2022, time.August, 17, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for tcName, tc := range testCases {
+		schedule, err := ParseSchedule(tc.schedule)
+		if err != nil {
+			t.Errorf("%s Got error %v while expecting none", tcName, err)
+			continue
+		}
+
+		if next := schedule.Next(tc.now); !next.Equal(tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, next, tc.expectedOutput)
+		}
+	}
+}
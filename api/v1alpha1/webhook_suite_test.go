@@ -35,7 +35,9 @@ import (
 
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	//+kubebuilder:scaffold:imports
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -80,6 +82,9 @@ var _ = BeforeSuite(func() {
 	Expect(cfg).NotTo(BeNil())
 
 	scheme := runtime.NewScheme()
+	err = clientgoscheme.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	err = AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
@@ -92,6 +97,18 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("creating the RuntimeEnvironmentCatalog")
+	catalog := &RuntimeEnvironmentCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: RuntimeEnvironmentCatalogSpec{
+			RuntimeEnvironments: []CatalogRuntimeEnvironment{
+				{OSName: "ubi", OSVersion: "8", PythonVersion: "3.8", BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+				{OSName: "ubi", OSVersion: "8", PythonVersion: "3.6", BaseImage: "quay.io/thoth-station/s2i-custom-notebook:latest"},
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, catalog)).Should(Succeed())
+
 	// start webhook server using Manager
 	webhookInstallOptions := &testEnv.WebhookInstallOptions
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
@@ -104,7 +121,7 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&CustomRuntimeEnvironment{}).SetupWebhookWithManager(mgr)
+	err = (&CustomRuntimeEnvironment{}).SetupWebhookWithManager(mgr, CustomRuntimeEnvironmentConfig{})
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
@@ -0,0 +1,228 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// BuildBackend runs the builds of CustomRuntimeEnvironments, each build is identified by its name
+// and labelled with the generation of the CustomRuntimeEnvironment it builds.
+type BuildBackend interface {
+	// SetupWithManager registers the indexes and watches of the build objects
+	SetupWithManager(mgr ctrl.Manager, bldr *builder.Builder) error
+	// Submit starts the build
+	Submit(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildRequest) error
+	// Status returns the status of the named build, nil if it does not exist
+	Status(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, name string) (*BuildStatus, error)
+	// Cancel stops the running builds retain does not keep, by their name and generation. A nil retain stops all
+	// running builds.
+	Cancel(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) error
+	// Cleanup deletes the builds retain does not keep, by their name and generation, together with their workspaces,
+	// and returns the names of the builds deleted. A nil retain deletes all builds, including the ones of unknown
+	// generation.
+	Cleanup(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) ([]string, error)
+}
+
+// BuildParam is a parameter of a build, array parameters have Values instead of a Value
+type BuildParam struct {
+	Name   string
+	Value  string
+	Values []string
+}
+
+// BuildRequest describes the build of a generation of a CustomRuntimeEnvironment
+type BuildRequest struct {
+	// Name of the build
+	Name string
+	// Pipeline is the name of the pipeline of the build type, e.g. package-list
+	Pipeline string
+	// Params of the pipeline
+	Params []BuildParam
+	// Workspace is the volume the build works in
+	Workspace meteorv1alpha1.WorkspaceSpec
+	// CABundle holds the CA certificates the build trusts, nil for the OpenShift service CA
+	CABundle *meteorv1alpha1.ConfigMapKeyReference
+	// GitSecret is the name of the secret the repository is cloned with, empty for public repositories
+	GitSecret string
+	// ImagePullSecret is the name of the dockerconfigjson secret the images are pulled with, empty for public images
+	ImagePullSecret string
+	// Timeout is the time the build may run before the backend stops it
+	Timeout time.Duration
+}
+
+// param returns the value of the named string parameter, empty if it is not set
+func (b *BuildRequest) param(name string) string {
+	for _, param := range b.Params {
+		if param.Name == name {
+			return param.Value
+		}
+	}
+
+	return ""
+}
+
+// unavailableBackendRequeueAfter is the time after which a CustomRuntimeEnvironment whose build backend is not
+// available checks again, in case the operator has been reconfigured meanwhile
+const unavailableBackendRequeueAfter = 5 * time.Minute
+
+// BuildState is the state of a build
+type BuildState string
+
+// states of a build
+const (
+	BuildRunning   BuildState = "Running"
+	BuildSucceeded BuildState = "Succeeded"
+	BuildFailed    BuildState = "Failed"
+	BuildCancelled BuildState = "Cancelled"
+)
+
+// BuildStatus is the status of a build
+type BuildStatus struct {
+	// Name of the build
+	Name  string
+	State BuildState
+	// StartTime is the time the build was submitted
+	StartTime *metav1.Time
+	// Pending is true while the build runs but none of its steps has started yet, e.g. because its workspace is not
+	// bound or its images cannot be pulled
+	Pending bool
+	// TimedOut is true if the backend stopped the failed build because it ran longer than its timeout
+	TimedOut bool
+	// Results reported by the build about the image it produced, see imageURLResult and friends
+	Results map[string]string
+	// CompletionTime is the time the build finished
+	CompletionTime *metav1.Time
+	// Failure describes why the build failed
+	Failure *meteorv1alpha1.BuildFailure
+}
+
+// NewBuildBackends returns the build backends available in the cluster. The Job backend is always available,
+// the Tekton one only if the Tekton CRDs are installed. The Job backend pushes to the OpenShift internal registry
+// unless a registry is configured, on clusters without one its builds fail to submit until a registry is configured.
+func NewBuildBackends(mgr ctrl.Manager, config meteorv1alpha1.CustomRuntimeEnvironmentConfig) (map[meteorv1alpha1.BuildBackend]BuildBackend, error) {
+	if err := validatePipelineConfigs(config.Pipelines); err != nil {
+		return nil, err
+	}
+
+	registry := config.JobBuildBackend.Registry
+	if registry == "" {
+		gvk := imagev1.GroupVersion.WithKind("ImageStream")
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if !meta.IsNoMatchError(err) {
+				return nil, err
+			}
+			ctrl.Log.WithName("setup").Info("No registry is configured for the Job build backend and the cluster is not OpenShift, builds run as Jobs are not submitted")
+		} else {
+			registry = defaultJobRegistry
+		}
+	}
+
+	backends := map[meteorv1alpha1.BuildBackend]BuildBackend{
+		meteorv1alpha1.JobBuildBackend: &jobBackend{
+			Client:       mgr.GetClient(),
+			Scheme:       mgr.GetScheme(),
+			APIReader:    mgr.GetAPIReader(),
+			BuilderImage: config.JobBuildBackend.BuilderImage,
+			Registry:     registry,
+		},
+	}
+
+	gvk := pipelinev1beta1.SchemeGroupVersion.WithKind("PipelineRun")
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+		ctrl.Log.WithName("setup").Info("Tekton is not installed, builds are run as Jobs only")
+	} else {
+		backends[meteorv1alpha1.TektonBuildBackend] = &tektonBackend{
+			Client:    mgr.GetClient(),
+			Scheme:    mgr.GetScheme(),
+			APIReader: mgr.GetAPIReader(),
+			Pipelines: config.Pipelines,
+		}
+	}
+
+	return backends, nil
+}
+
+// backend returns the build backend selected for the CustomRuntimeEnvironment
+func (r *CustomRuntimeEnvironmentReconciler) backend(cre *meteorv1alpha1.CustomRuntimeEnvironment) (BuildBackend, error) {
+	name := cre.Spec.BuildBackend
+	if name == "" {
+		name = r.DefaultBuildBackend
+	}
+	if name == "" {
+		name = meteorv1alpha1.TektonBuildBackend
+	}
+
+	backend, ok := r.Backends[name]
+	if !ok {
+		return nil, fmt.Errorf("the %s build backend is not available", name)
+	}
+
+	return backend, nil
+}
+
+// indexBuildOwner indexes builds by the name of their controlling CustomRuntimeEnvironment
+func indexBuildOwner(rawObj client.Object) []string {
+	owner := metav1.GetControllerOf(rawObj)
+	if owner == nil {
+		return nil
+	}
+	if owner.APIVersion != meteorv1alpha1.GroupVersion.String() || owner.Kind != "CustomRuntimeEnvironment" {
+		return nil
+	}
+
+	return []string{owner.Name}
+}
+
+// buildGeneration returns the generation of the CustomRuntimeEnvironment a build belongs to
+func buildGeneration(build client.Object) (int64, bool) {
+	generation, err := strconv.ParseInt(build.GetLabels()[generationLabelKey], 10, 64)
+	if err != nil {
+		// not created by us, or by an older version of the operator
+		return 0, false
+	}
+
+	return generation, true
+}
+
+// isDiscarded returns true if the build is not retained, i.e. Cancel has to stop it and Cleanup has to delete it
+func isDiscarded(build client.Object, retain func(name string, generation int64) bool) bool {
+	if retain == nil {
+		return true
+	}
+	generation, ok := buildGeneration(build)
+
+	return ok && !retain(build.GetName(), generation)
+}
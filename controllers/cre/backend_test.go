@@ -0,0 +1,118 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestBackend tests if the build backend of the CustomRuntimeEnvironment wins over the default one
+func TestBackend(t *testing.T) {
+	tekton := &tektonBackend{}
+	job := &jobBackend{}
+
+	testCases := map[string]struct {
+		backends       map[meteorv1alpha1.BuildBackend]BuildBackend
+		defaultBackend meteorv1alpha1.BuildBackend
+		buildBackend   meteorv1alpha1.BuildBackend
+		expectedOutput BuildBackend
+	}{
+		"tekton-by-default": {
+			backends:       map[meteorv1alpha1.BuildBackend]BuildBackend{meteorv1alpha1.TektonBuildBackend: tekton, meteorv1alpha1.JobBuildBackend: job},
+			expectedOutput: tekton,
+		},
+		"configured-default": {
+			backends:       map[meteorv1alpha1.BuildBackend]BuildBackend{meteorv1alpha1.TektonBuildBackend: tekton, meteorv1alpha1.JobBuildBackend: job},
+			defaultBackend: meteorv1alpha1.JobBuildBackend,
+			expectedOutput: job,
+		},
+		"selected-by-cre": {
+			backends:       map[meteorv1alpha1.BuildBackend]BuildBackend{meteorv1alpha1.TektonBuildBackend: tekton, meteorv1alpha1.JobBuildBackend: job},
+			defaultBackend: meteorv1alpha1.JobBuildBackend,
+			buildBackend:   meteorv1alpha1.TektonBuildBackend,
+			expectedOutput: tekton,
+		},
+		"tekton-not-installed": {
+			backends:       map[meteorv1alpha1.BuildBackend]BuildBackend{meteorv1alpha1.JobBuildBackend: job},
+			buildBackend:   meteorv1alpha1.TektonBuildBackend,
+			expectedOutput: nil,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		r := &CustomRuntimeEnvironmentReconciler{Backends: tc.backends, DefaultBuildBackend: tc.defaultBackend}
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildBackend: tc.buildBackend},
+		}
+
+		output, err := r.backend(cre)
+		if tc.expectedOutput == nil {
+			if err == nil {
+				t.Errorf("%s Got no error while expecting one", tcName)
+			}
+			continue
+		}
+		if output != tc.expectedOutput {
+			t.Errorf("%s Got %T while expecting %T", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestIsDiscarded tests if only the builds of generations not retained are discarded, unless all are
+func TestIsDiscarded(t *testing.T) {
+	retainCurrent := func(_ string, generation int64) bool { return generation >= 3 }
+
+	testCases := map[string]struct {
+		labels         map[string]string
+		retain         func(name string, generation int64) bool
+		expectedOutput bool
+	}{
+		"current-generation": {
+			labels:         map[string]string{generationLabelKey: "3"},
+			retain:         retainCurrent,
+			expectedOutput: false,
+		},
+		"previous-generation": {
+			labels:         map[string]string{generationLabelKey: "2"},
+			retain:         retainCurrent,
+			expectedOutput: true,
+		},
+		"unknown-generation": {
+			labels:         map[string]string{},
+			retain:         retainCurrent,
+			expectedOutput: false,
+		},
+		"all": {
+			labels:         map[string]string{},
+			retain:         nil,
+			expectedOutput: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		build := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: tc.labels}}
+
+		if output := isDiscarded(build, tc.retain); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	imagev1 "github.com/openshift/api/image/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// baseImageTag is the tag of the ImageStream importing the base image of a CustomRuntimeEnvironment
+const baseImageTag = "latest"
+
+// baseImageStreamName returns the name of the ImageStream importing the base image of the CustomRuntimeEnvironment
+func baseImageStreamName(cre *meteorv1alpha1.CustomRuntimeEnvironment) string {
+	return fmt.Sprintf("cre-%s-base", cre.Name)
+}
+
+// trackedBaseImage returns the base image the image of the CustomRuntimeEnvironment is built on, if it is known.
+// The builds of git repositories pick their base image themselves, it is known once they reported it.
+func trackedBaseImage(cre *meteorv1alpha1.CustomRuntimeEnvironment) string {
+	switch {
+	case cre.Spec.BuildType.BuildsOnBaseImage() && cre.Spec.BaseImage != "":
+		return cre.Spec.BaseImage
+	case cre.Spec.BuildType.BuildsOnBaseImage():
+		return cre.Status.ResolvedBaseImage
+	case cre.Spec.BuildType == meteorv1alpha1.GitRepository && cre.Status.Image != nil:
+		return cre.Status.Image.BaseImage
+	}
+
+	return ""
+}
+
+// baseImageDigest returns the current digest of the base image, empty if it is not known yet. Base images referenced
+// by tag are imported by an ImageStream owned by the CustomRuntimeEnvironment, which the cluster imports again
+// periodically, so that their updates are noticed.
+func (r *CustomRuntimeEnvironmentReconciler) baseImageDigest(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, baseImage string) (string, error) {
+	if ref, err := name.ParseReference(baseImage); err == nil {
+		if digest, ok := ref.(name.Digest); ok {
+			return digest.DigestStr(), nil
+		}
+	}
+	if !r.trackBaseImages {
+		return "", nil
+	}
+
+	imageStream := &imagev1.ImageStream{}
+	imageStream.Name = baseImageStreamName(cre)
+	imageStream.Namespace = cre.Namespace
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, imageStream, func() error {
+		from := &v1.ObjectReference{Kind: "DockerImage", Name: baseImage}
+		for i := range imageStream.Spec.Tags {
+			tag := &imageStream.Spec.Tags[i]
+			if tag.Name == baseImageTag {
+				tag.From = from
+				tag.ImportPolicy.Scheduled = true
+				tag.ReferencePolicy.Type = imagev1.SourceTagReferencePolicy
+				return controllerutil.SetControllerReference(cre, imageStream, r.Scheme)
+			}
+		}
+		imageStream.Spec.Tags = append(imageStream.Spec.Tags, imagev1.TagReference{
+			Name:            baseImageTag,
+			From:            from,
+			ImportPolicy:    imagev1.TagImportPolicy{Scheduled: true},
+			ReferencePolicy: imagev1.TagReferencePolicy{Type: imagev1.SourceTagReferencePolicy},
+		})
+		return controllerutil.SetControllerReference(cre, imageStream, r.Scheme)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return importedDigest(imageStream, baseImageTag), nil
+}
+
+// importedDigest returns the digest of the image last imported into the tag of the ImageStream, empty if the tag
+// has not been imported since its spec changed
+func importedDigest(imageStream *imagev1.ImageStream, tag string) string {
+	var generation *int64
+	for _, tagRef := range imageStream.Spec.Tags {
+		if tagRef.Name == tag {
+			generation = tagRef.Generation
+		}
+	}
+
+	for _, events := range imageStream.Status.Tags {
+		if events.Tag != tag || len(events.Items) == 0 {
+			continue
+		}
+		if generation != nil && events.Items[0].Generation < *generation {
+			return ""
+		}
+		return events.Items[0].Image
+	}
+
+	return ""
+}
+
+// pinBaseImage records the digest of the base image the build is submitted against, and returns the base image
+// pinned to it, so that the build uses the image of the recorded digest
+func (r *CustomRuntimeEnvironmentReconciler) pinBaseImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, baseImage string) string {
+	cre.Status.BuildBaseImageDigest = ""
+	if cre.Spec.IgnoreBaseImageUpdates || baseImage == "" {
+		return baseImage
+	}
+
+	digest, err := r.baseImageDigest(ctx, cre, baseImage)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Unable to track the base image", "baseImage", baseImage)
+		return baseImage
+	}
+	cre.Status.BuildBaseImageDigest = digest
+
+	return (&meteorv1alpha1.ImageStatus{PullSpec: baseImage, Digest: digest}).PinnedPullSpec()
+}
+
+// reconcileBaseImage starts a new build of the current generation of the CustomRuntimeEnvironment once its base
+// image has been updated since the last build was submitted, unless the last build has not finished yet
+func (r *CustomRuntimeEnvironmentReconciler) reconcileBaseImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) {
+	logger := log.FromContext(ctx)
+
+	baseImage := trackedBaseImage(cre)
+	if cre.Spec.IgnoreBaseImageUpdates || baseImage == "" {
+		return
+	}
+	digest, err := r.baseImageDigest(ctx, cre, baseImage)
+	if err != nil {
+		logger.Error(err, "Unable to track the base image", "baseImage", baseImage)
+		return
+	}
+
+	// the digest of the base image is not known before the ImageStream has imported it, the build which succeeded
+	// meanwhile is taken to be built against the first digest imported
+	if cre.Status.BuildBaseImageDigest == "" && cre.Status.Phase == meteorv1alpha1.PhaseSucceeded {
+		cre.Status.BuildBaseImageDigest = digest
+	}
+
+	if !baseImageUpdated(cre, digest) {
+		return
+	}
+	logger.Info("Base image updated, rebuilding", "baseImage", baseImage, "digest", digest, "previousDigest", cre.Status.BuildBaseImageDigest)
+	cre.Rebuild()
+}
+
+// baseImageUpdated returns true if the image of the CustomRuntimeEnvironment has to be built again on the current
+// digest of its base image: its last build finished and was submitted against another digest. A build which failed on
+// the updated base image is not started again.
+func baseImageUpdated(cre *meteorv1alpha1.CustomRuntimeEnvironment, digest string) bool {
+	if cre.Spec.IgnoreBaseImageUpdates || digest == "" || cre.Status.BuildBaseImageDigest == "" {
+		return false
+	}
+
+	switch cre.Status.Phase {
+	case meteorv1alpha1.PhaseSucceeded, meteorv1alpha1.PhaseFailed, meteorv1alpha1.PhaseCancelled:
+		return digest != cre.Status.BuildBaseImageDigest
+	}
+
+	return false
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestTrackedBaseImage tests if the base image given, resolved or reported by the previous build is tracked
+func TestTrackedBaseImage(t *testing.T) {
+	testCases := map[string]struct {
+		spec           meteorv1alpha1.CustomRuntimeEnvironmentSpec
+		status         meteorv1alpha1.CustomRuntimeEnvironmentStatus
+		expectedOutput string
+	}{
+		"package-list-base-image": {
+			spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+				BuildType: meteorv1alpha1.PackageList,
+				BaseImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			}},
+			expectedOutput: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+		},
+		"package-list-runtime-environment": {
+			spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+				BuildTypeSpec:      meteorv1alpha1.BuildTypeSpec{BuildType: meteorv1alpha1.PackageList},
+				RuntimeEnvironment: meteorv1alpha1.CustomRuntimeEnvironmentRuntimeSpec{PythonVersion: "3.8"},
+			},
+			status:         meteorv1alpha1.CustomRuntimeEnvironmentStatus{ResolvedBaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+			expectedOutput: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+		},
+		"git-repository": {
+			spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+				BuildType:  meteorv1alpha1.GitRepository,
+				Repository: "https://github.com/thoth-station/meteor-operator.git",
+			}},
+			status:         meteorv1alpha1.CustomRuntimeEnvironmentStatus{Image: &meteorv1alpha1.ImageStatus{BaseImage: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"}},
+			expectedOutput: "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+		},
+		"git-repository-not-built": {
+			spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+				BuildType:  meteorv1alpha1.GitRepository,
+				Repository: "https://github.com/thoth-station/meteor-operator.git",
+			}},
+			expectedOutput: "",
+		},
+		"import": {
+			spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+				BuildType: meteorv1alpha1.ImportImage,
+				FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+			}},
+			expectedOutput: "",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{Spec: tc.spec, Status: tc.status}
+
+		if output := trackedBaseImage(cre); output != tc.expectedOutput {
+			t.Errorf("%s Got %q while expecting %q", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestImportedDigest tests if the digest last imported into a tag is found, unless the tag changed since
+func TestImportedDigest(t *testing.T) {
+	generation := func(g int64) *int64 {
+		return &g
+	}
+
+	testCases := map[string]struct {
+		imageStream    imagev1.ImageStream
+		expectedOutput string
+	}{
+		"imported": {
+			imageStream: imagev1.ImageStream{
+				Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{{Name: "latest", Generation: generation(2)}}},
+				Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{
+					{Tag: "latest", Items: []imagev1.TagEvent{{Image: "sha256:0456", Generation: 2}, {Image: "sha256:0123", Generation: 1}}},
+				}},
+			},
+			expectedOutput: "sha256:0456",
+		},
+		"not-imported-yet": {
+			imageStream: imagev1.ImageStream{
+				Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{{Name: "latest", Generation: generation(1)}}},
+			},
+			expectedOutput: "",
+		},
+		"spec-changed": {
+			imageStream: imagev1.ImageStream{
+				Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{{Name: "latest", Generation: generation(3)}}},
+				Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{
+					{Tag: "latest", Items: []imagev1.TagEvent{{Image: "sha256:0456", Generation: 2}}},
+				}},
+			},
+			expectedOutput: "",
+		},
+		"other-tag": {
+			imageStream: imagev1.ImageStream{
+				Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{
+					{Tag: "v0.2.2", Items: []imagev1.TagEvent{{Image: "sha256:0456", Generation: 2}}},
+				}},
+			},
+			expectedOutput: "",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := importedDigest(&tc.imageStream, "latest"); output != tc.expectedOutput {
+			t.Errorf("%s Got %q while expecting %q", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestBaseImageUpdated tests if an image is built again once its last build finished on another digest of the base image
+func TestBaseImageUpdated(t *testing.T) {
+	testCases := map[string]struct {
+		phase          meteorv1alpha1.Phase
+		buildDigest    string
+		digest         string
+		ignoreUpdates  bool
+		expectedOutput bool
+	}{
+		"updated": {
+			phase:          meteorv1alpha1.PhaseSucceeded,
+			buildDigest:    "sha256:0123",
+			digest:         "sha256:0456",
+			expectedOutput: true,
+		},
+		"unchanged": {
+			phase:          meteorv1alpha1.PhaseSucceeded,
+			buildDigest:    "sha256:0123",
+			digest:         "sha256:0123",
+			expectedOutput: false,
+		},
+		"updated-after-failure": {
+			phase:          meteorv1alpha1.PhaseFailed,
+			buildDigest:    "sha256:0123",
+			digest:         "sha256:0456",
+			expectedOutput: true,
+		},
+		"failed-on-update": {
+			phase:          meteorv1alpha1.PhaseFailed,
+			buildDigest:    "sha256:0456",
+			digest:         "sha256:0456",
+			expectedOutput: false,
+		},
+		"running": {
+			phase:          meteorv1alpha1.PhaseRunning,
+			buildDigest:    "sha256:0123",
+			digest:         "sha256:0456",
+			expectedOutput: false,
+		},
+		"not-imported-yet": {
+			phase:          meteorv1alpha1.PhaseSucceeded,
+			buildDigest:    "sha256:0123",
+			digest:         "",
+			expectedOutput: false,
+		},
+		"built-against-unknown-digest": {
+			phase:          meteorv1alpha1.PhaseSucceeded,
+			buildDigest:    "",
+			digest:         "sha256:0456",
+			expectedOutput: false,
+		},
+		"ignored": {
+			phase:          meteorv1alpha1.PhaseSucceeded,
+			buildDigest:    "sha256:0123",
+			digest:         "sha256:0456",
+			ignoreUpdates:  true,
+			expectedOutput: false,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec:   meteorv1alpha1.CustomRuntimeEnvironmentSpec{IgnoreBaseImageUpdates: tc.ignoreUpdates},
+			Status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{Phase: tc.phase, BuildBaseImageDigest: tc.buildDigest},
+		}
+
+		if output := baseImageUpdated(cre, tc.digest); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
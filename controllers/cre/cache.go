@@ -0,0 +1,333 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	imagev1 "github.com/openshift/api/image/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// gitCommitPattern matches a full git commit hash, the only git refs which do not move
+var gitCommitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// uncachedParams are the parameters of the builds which describe the image rather than its content
+var uncachedParams = map[string]bool{"name": true, "creator": true, "description": true}
+
+// buildCacheKey returns the content hash of the normalised inputs of a build: its build type, the Pipeline running it
+// and its parameters, e.g. the base image digest, the sorted package specifiers and the git commit. The GitRepository
+// builds pick their base image themselves, the digest of the base image tracked for them is part of their inputs. It
+// returns an empty key if the inputs do not identify the content of the image, i.e. if they refer to a git branch or
+// tag, or to a base image by tag only, including the FROM images of a Containerfile and the unknown base image of a
+// GitRepository.
+func buildCacheKey(buildType meteorv1alpha1.BuildType, pipelineRef *meteorv1alpha1.PipelineReference, params []BuildParam, baseImageDigest string) string {
+	byName := map[string]BuildParam{}
+	names := []string{}
+	for _, param := range params {
+		if uncachedParams[param.Name] {
+			continue
+		}
+		if _, ok := byName[param.Name]; !ok {
+			names = append(names, param.Name)
+		}
+		byName[param.Name] = param
+	}
+	sort.Strings(names)
+
+	if byName["url"].Value != "" && !gitCommitPattern.MatchString(byName["ref"].Value) {
+		return ""
+	}
+	if baseImage, ok := byName["baseImage"]; ok && !isPinnedImageReference(baseImage.Value) {
+		return ""
+	}
+	switch buildType {
+	case meteorv1alpha1.GitRepository:
+		if baseImageDigest == "" {
+			return ""
+		}
+	case meteorv1alpha1.Containerfile:
+		// the Containerfile of a repository is not known before the build
+		containerfile := byName["containerfile"].Value
+		if containerfile == "" {
+			return ""
+		}
+		for _, baseImage := range containerfileBaseImages(containerfile) {
+			if !isPinnedImageReference(baseImage) {
+				return ""
+			}
+		}
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "buildType=%s\n", buildType)
+	if pipelineRef != nil {
+		fmt.Fprintf(hash, "pipelineRef=%+v\n", *pipelineRef)
+	}
+	if buildType == meteorv1alpha1.GitRepository {
+		fmt.Fprintf(hash, "baseImageDigest=%s\n", baseImageDigest)
+	}
+	for _, paramName := range names {
+		param := byName[paramName]
+		switch {
+		case param.Values != nil:
+			values := append([]string{}, param.Values...)
+			sort.Strings(values)
+			fmt.Fprintf(hash, "%s=%q\n", paramName, strings.Join(values, "\n"))
+		case paramName == "baseImage":
+			fmt.Fprintf(hash, "%s=%q\n", paramName, normalizeImageReference(param.Value))
+		default:
+			fmt.Fprintf(hash, "%s=%q\n", paramName, param.Value)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// containerfileBaseImages returns the images the stages of the Containerfile start from, skipping scratch and the
+// stages starting from a previous stage
+func containerfileBaseImages(content string) []string {
+	images := []string{}
+	stages := map[string]bool{"scratch": true}
+	continued := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// lines continuing an instruction are not instructions themselves
+		wasContinued := continued
+		continued = strings.HasSuffix(line, "\\")
+		if wasContinued {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if strings.ToUpper(fields[0]) != "FROM" {
+			continue
+		}
+		// FROM [--platform=<platform>] <image> [AS <name>]
+		args := []string{}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "--") {
+				args = append(args, field)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !stages[strings.ToLower(args[0])] {
+			images = append(images, args[0])
+		}
+		if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
+		}
+	}
+
+	return images
+}
+
+// isPinnedImageReference returns true if the image is referenced by digest, the only image references which do not move
+func isPinnedImageReference(image string) bool {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return false
+	}
+	_, ok := ref.(name.Digest)
+
+	return ok
+}
+
+// normalizeImageReference returns the fully qualified image reference, e.g.
+// index.docker.io/library/python@sha256:... for python:3.8@sha256:..., so that references to the same image share
+// their key.
+func normalizeImageReference(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Name()
+}
+
+// indexBuildCacheKey indexes CustomRuntimeEnvironments by the content hash of the inputs of their image
+func indexBuildCacheKey(rawObj client.Object) []string {
+	cre, ok := rawObj.(*meteorv1alpha1.CustomRuntimeEnvironment)
+	if !ok || cre.Status.Image == nil || cre.Status.Image.CacheKey == "" {
+		return nil
+	}
+
+	return []string{cre.Status.Image.CacheKey}
+}
+
+// cachedImage returns the CustomRuntimeEnvironment of the namespace whose image was built last from the inputs of the
+// given content hash, nil if there is none
+func (r *CustomRuntimeEnvironmentReconciler) cachedImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, key string) (*meteorv1alpha1.CustomRuntimeEnvironment, error) {
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(ctx, cres, client.InNamespace(cre.Namespace), client.MatchingFields{buildCacheKeyField: key}); err != nil {
+		return nil, err
+	}
+
+	var source *meteorv1alpha1.CustomRuntimeEnvironment
+	for i := range cres.Items {
+		candidate := &cres.Items[i]
+		if candidate.Name == cre.Name || !candidate.DeletionTimestamp.IsZero() || candidate.Status.Image.PullSpec == "" {
+			continue
+		}
+		if source == nil || builtBefore(source.Status.Image, candidate.Status.Image) {
+			source = candidate
+		}
+	}
+
+	return source, nil
+}
+
+// builtBefore returns true if the image a was built before the image b
+func builtBefore(a, b *meteorv1alpha1.ImageStatus) bool {
+	if a.BuildTime == nil || b.BuildTime == nil {
+		return a.BuildTime == nil && b.BuildTime != nil
+	}
+
+	return a.BuildTime.Before(b.BuildTime)
+}
+
+// isCacheHit returns true if the image of the current generation has been reused from the build cache and not been
+// rebuilt since. The CacheHit condition outlives the generation it was reported for.
+func isCacheHit(cre *meteorv1alpha1.CustomRuntimeEnvironment) bool {
+	condition := meta.FindStatusCondition(cre.Status.Conditions, meteorv1alpha1.CacheHit)
+
+	return condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == cre.Generation && cre.Status.Rebuilds == 0
+}
+
+// reuseCachedImage satisfies the build of the CustomRuntimeEnvironment with the image another CustomRuntimeEnvironment
+// of the namespace built from the same inputs, if there is one. The image is tagged into the ImageStream the build
+// would have pushed it to, so that it stays available when the other CustomRuntimeEnvironment is deleted.
+func (r *CustomRuntimeEnvironmentReconciler) reuseCachedImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, buildName, key string, statusIndex int) bool {
+	logger := log.FromContext(ctx)
+
+	source, err := r.cachedImage(ctx, cre, key)
+	if err != nil {
+		logger.Error(err, "Unable to look up the build cache, building the image")
+		return false
+	}
+	if source == nil {
+		return false
+	}
+
+	image, err := r.retagImage(ctx, cre, buildName, source.Status.Image)
+	if err != nil {
+		logger.Error(err, "Unable to reuse the image from the build cache, building the image", "source", source.Name)
+		return false
+	}
+	logger.Info("Reusing image from the build cache", "source", source.Name, "image", image.PullSpec)
+
+	image.CacheKey = key
+	cre.Status.Image = image
+	cre.Status.BuildCacheKey = key
+	cre.Status.Failure = nil
+	cre.Status.Pipelines[statusIndex].Ready = "True"
+	cre.Status.Pipelines[statusIndex].Url = image.PullSpec
+
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.CacheHit,
+		Status:             metav1.ConditionTrue,
+		Reason:             "BuildCacheHit",
+		Message:            fmt.Sprintf("The image CustomRuntimeEnvironment %s built from the same inputs has been reused.", source.Name),
+	})
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.PipelineRunCompleted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "BuildCacheHit",
+		Message:            "No PipelineRun was needed, the image has been reused from the build cache.",
+	})
+	if condition, ok := meteorv1alpha1.BuildConditions[cre.Spec.BuildType]; ok {
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               condition.Type,
+			Status:             metav1.ConditionTrue,
+			Reason:             condition.SucceededReason,
+			Message:            condition.SucceededMessage,
+		})
+	}
+
+	return true
+}
+
+// retagImage tags the image into the ImageStream named after the build, pinned to its digest, and returns the image
+// status of the tag. The image is shared as is on clusters without ImageStreams.
+func (r *CustomRuntimeEnvironmentReconciler) retagImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, buildName string, source *meteorv1alpha1.ImageStatus) (*meteorv1alpha1.ImageStatus, error) {
+	image := source.DeepCopy()
+	if source.ImageStreamName == "" {
+		return image, nil
+	}
+
+	from := &v1.ObjectReference{Kind: "ImageStreamTag", Name: source.ImageStreamName + ":" + source.ImageStreamTag}
+	if source.Digest != "" {
+		from = &v1.ObjectReference{Kind: "ImageStreamImage", Name: source.ImageStreamName + "@" + source.Digest}
+	}
+	imageStream := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Name: buildName, Namespace: cre.Namespace},
+		Spec: imagev1.ImageStreamSpec{
+			Tags: []imagev1.TagReference{{
+				Name:            "latest",
+				From:            from,
+				ReferencePolicy: imagev1.TagReferencePolicy{Type: imagev1.LocalTagReferencePolicy},
+			}},
+		},
+	}
+	if err := r.Create(ctx, imageStream); err != nil {
+		if meta.IsNoMatchError(err) {
+			return image, nil
+		}
+		if !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		if err := r.Get(ctx, types.NamespacedName{Name: buildName, Namespace: cre.Namespace}, imageStream); err != nil {
+			return nil, err
+		}
+	}
+
+	image.ImageStreamName = buildName
+	image.ImageStreamTag = "latest"
+	if imageStream.Status.DockerImageRepository != "" {
+		image.PullSpec = imageStream.Status.DockerImageRepository + ":latest"
+	}
+
+	return image, nil
+}
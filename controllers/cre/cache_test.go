@@ -0,0 +1,261 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestBuildCacheKey tests if builds from the same normalised inputs share their cache key, and builds from other
+// inputs or from git refs and base image tags which may move do not, including the FROM images of Containerfiles and
+// the base images of GitRepository builds
+func TestBuildCacheKey(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	const digest = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	const otherDigest = "sha256:60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+
+	packageList := []BuildParam{
+		{Name: "name", Value: "Student 1"},
+		{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest@" + digest},
+		{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.1"}},
+	}
+	gitRepository := func(ref string) []BuildParam {
+		return []BuildParam{
+			{Name: "url", Value: "https://github.com/thoth-station/meteor-operator.git"},
+			{Name: "ref", Value: ref},
+		}
+	}
+	containerfile := func(content string) []BuildParam {
+		return []BuildParam{{Name: "url"}, {Name: "ref"}, {Name: "containerfile", Value: content}}
+	}
+
+	testCases := map[string]struct {
+		buildType     meteorv1alpha1.BuildType
+		pipelineRef   *meteorv1alpha1.PipelineReference
+		params        []BuildParam
+		digest        string
+		expectedEqual bool
+		expectedEmpty bool
+	}{
+		"same-inputs": {
+			buildType:     meteorv1alpha1.PackageList,
+			params:        packageList,
+			expectedEqual: true,
+		},
+		"reordered-packages-and-annotations": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "packages", Values: []string{"numpy==1.23.1", "pandas==1.4.3"}},
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook@" + digest},
+				{Name: "name", Value: "Student 2"},
+				{Name: "creator", Value: "student-2"},
+			},
+			expectedEqual: true,
+		},
+		"other-package": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook@" + digest},
+				{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.2"}},
+			},
+			expectedEqual: false,
+		},
+		"other-base-image": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-minimal-py38-notebook@" + digest},
+				{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.1"}},
+			},
+			expectedEqual: false,
+		},
+		"updated-base-image": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest@" + otherDigest},
+				{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.1"}},
+			},
+			expectedEqual: false,
+		},
+		"base-image-tag": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+				{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.1"}},
+			},
+			expectedEmpty: true,
+		},
+		"base-image-default-tag": {
+			buildType: meteorv1alpha1.PackageList,
+			params: []BuildParam{
+				{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook"},
+				{Name: "packages", Values: []string{"pandas==1.4.3", "numpy==1.23.1"}},
+			},
+			expectedEmpty: true,
+		},
+		"other-build-type": {
+			buildType:     meteorv1alpha1.Pipenv,
+			params:        packageList,
+			expectedEqual: false,
+		},
+		"other-pipeline": {
+			buildType:     meteorv1alpha1.PackageList,
+			pipelineRef:   &meteorv1alpha1.PipelineReference{Name: "custom-package-list"},
+			params:        packageList,
+			expectedEqual: false,
+		},
+		"git-commit": {
+			buildType:     meteorv1alpha1.GitRepository,
+			params:        gitRepository(commit),
+			digest:        digest,
+			expectedEqual: false,
+		},
+		"git-commit-unknown-base-image": {
+			buildType:     meteorv1alpha1.GitRepository,
+			params:        gitRepository(commit),
+			expectedEmpty: true,
+		},
+		"git-branch": {
+			buildType:     meteorv1alpha1.GitRepository,
+			params:        gitRepository("main"),
+			digest:        digest,
+			expectedEmpty: true,
+		},
+		"git-default-branch": {
+			buildType:     meteorv1alpha1.GitRepository,
+			params:        gitRepository(""),
+			digest:        digest,
+			expectedEmpty: true,
+		},
+		"containerfile-pinned": {
+			buildType:     meteorv1alpha1.Containerfile,
+			params:        containerfile("FROM quay.io/thoth-station/s2i-custom-py38-notebook@" + digest + "\nRUN pip install graphviz"),
+			expectedEqual: false,
+		},
+		"containerfile-tag": {
+			buildType:     meteorv1alpha1.Containerfile,
+			params:        containerfile("FROM quay.io/thoth-station/s2i-custom-py38-notebook:latest\nRUN pip install graphviz"),
+			expectedEmpty: true,
+		},
+		"containerfile-stages-pinned": {
+			buildType: meteorv1alpha1.Containerfile,
+			params: containerfile("ARG PYTHON=3.8\nFROM --platform=linux/amd64 quay.io/thoth-station/s2i-custom-py38-notebook@" + digest + " AS builder\n" +
+				"RUN pip wheel graphviz \\\n  --wheel-dir /tmp/wheels\nFROM builder\nFROM scratch\nCOPY --from=builder /tmp/wheels /wheels"),
+			expectedEqual: false,
+		},
+		"containerfile-stage-tag": {
+			buildType: meteorv1alpha1.Containerfile,
+			params: containerfile("FROM quay.io/thoth-station/s2i-custom-py38-notebook@" + digest + " AS builder\n" +
+				"FROM quay.io/thoth-station/s2i-minimal-py38-notebook:latest\nCOPY --from=builder /tmp/wheels /wheels"),
+			expectedEmpty: true,
+		},
+		"containerfile-from-repository": {
+			buildType: meteorv1alpha1.Containerfile,
+			params: []BuildParam{
+				{Name: "url", Value: "https://github.com/thoth-station/meteor-operator.git"},
+				{Name: "ref", Value: commit},
+				{Name: "containerfilePath", Value: "Containerfile"},
+				{Name: "containerfile"},
+			},
+			expectedEmpty: true,
+		},
+	}
+
+	expectedKey := buildCacheKey(meteorv1alpha1.PackageList, nil, packageList, "")
+	for tcName, tc := range testCases {
+		key := buildCacheKey(tc.buildType, tc.pipelineRef, tc.params, tc.digest)
+
+		if tc.expectedEmpty {
+			if key != "" {
+				t.Errorf("%s Got cache key %s while expecting none", tcName, key)
+			}
+			continue
+		}
+		if key == "" {
+			t.Errorf("%s Got no cache key while expecting one", tcName)
+		}
+		if (key == expectedKey) != tc.expectedEqual {
+			t.Errorf("%s Got cache key %s while expecting it equal to %s: %v", tcName, key, expectedKey, tc.expectedEqual)
+		}
+	}
+
+	if buildCacheKey(meteorv1alpha1.GitRepository, nil, gitRepository(commit), digest) != buildCacheKey(meteorv1alpha1.GitRepository, nil, gitRepository(commit), digest) {
+		t.Errorf("git-commit Got different cache keys while expecting the same one")
+	}
+	if buildCacheKey(meteorv1alpha1.GitRepository, nil, gitRepository(commit), digest) == buildCacheKey(meteorv1alpha1.GitRepository, nil, gitRepository(commit), otherDigest) {
+		t.Errorf("git-commit-updated-base-image Got the same cache key while expecting different ones")
+	}
+}
+
+// TestBuiltBefore tests if the image built last is found, images without build time having been built first
+func TestBuiltBefore(t *testing.T) {
+	now := metav1.Now()
+	earlier := metav1.NewTime(now.Add(-time.Hour))
+
+	testCases := map[string]struct {
+		a        *meteorv1alpha1.ImageStatus
+		b        *meteorv1alpha1.ImageStatus
+		expected bool
+	}{
+		"earlier":        {a: &meteorv1alpha1.ImageStatus{BuildTime: &earlier}, b: &meteorv1alpha1.ImageStatus{BuildTime: &now}, expected: true},
+		"later":          {a: &meteorv1alpha1.ImageStatus{BuildTime: &now}, b: &meteorv1alpha1.ImageStatus{BuildTime: &earlier}, expected: false},
+		"no-build-time":  {a: &meteorv1alpha1.ImageStatus{}, b: &meteorv1alpha1.ImageStatus{BuildTime: &earlier}, expected: true},
+		"no-build-times": {a: &meteorv1alpha1.ImageStatus{}, b: &meteorv1alpha1.ImageStatus{}, expected: false},
+	}
+
+	for tcName, tc := range testCases {
+		if builtBefore(tc.a, tc.b) != tc.expected {
+			t.Errorf("%s Got built before %v while expecting %v", tcName, !tc.expected, tc.expected)
+		}
+	}
+}
+
+// TestIsCacheHit tests if the image reused from the build cache is only kept for the generation it was reused for,
+// and until it is rebuilt
+func TestIsCacheHit(t *testing.T) {
+	testCases := map[string]struct {
+		generation     int64
+		rebuilds       int32
+		status         metav1.ConditionStatus
+		expectedOutput bool
+	}{
+		"cache-hit":        {generation: 2, status: metav1.ConditionTrue, expectedOutput: true},
+		"other-generation": {generation: 3, status: metav1.ConditionTrue, expectedOutput: false},
+		"rebuilt":          {generation: 2, rebuilds: 1, status: metav1.ConditionTrue, expectedOutput: false},
+		"no-cache-hit":     {generation: 2, status: metav1.ConditionFalse, expectedOutput: false},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			ObjectMeta: metav1.ObjectMeta{Generation: tc.generation},
+			Status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{
+				Rebuilds: tc.rebuilds,
+				Conditions: []metav1.Condition{
+					{Type: meteorv1alpha1.CacheHit, Status: tc.status, Reason: "BuildCacheHit", ObservedGeneration: 2},
+				},
+			},
+		}
+
+		if output := isCacheHit(cre); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// resolveBaseImage looks up the base image for the runtime environment of a build in the RuntimeEnvironmentCatalogs
+func (r *CustomRuntimeEnvironmentReconciler) resolveBaseImage(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) (string, error) {
+	catalogs := &meteorv1alpha1.RuntimeEnvironmentCatalogList{}
+	if err := r.List(ctx, catalogs); err != nil {
+		return "", fmt.Errorf("unable to list RuntimeEnvironmentCatalogs: %w", err)
+	}
+
+	runtime := cre.Spec.RuntimeEnvironment
+	baseImage, ok := catalogs.ResolveBaseImage(runtime)
+	if !ok {
+		return "", fmt.Errorf("no RuntimeEnvironmentCatalog provides a base image for %s %s with Python %s", runtime.OSName, runtime.OSVersion, runtime.PythonVersion)
+	}
+
+	return baseImage, nil
+}
+
+// unresolvedCustomRuntimeEnvironments maps a changed RuntimeEnvironmentCatalog to the CustomRuntimeEnvironments
+// which are waiting for their runtime environment to be resolved, so they are retried
+func (r *CustomRuntimeEnvironmentReconciler) unresolvedCustomRuntimeEnvironments(catalog client.Object) []reconcile.Request {
+	logger := log.Log.WithValues("runtimeenvironmentcatalog", catalog.GetName())
+
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(context.Background(), cres); err != nil {
+		logger.Error(err, "Unable to list CustomRuntimeEnvironments")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, cre := range cres.Items {
+		if meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.ErrorResolvingBaseImage) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name}})
+		}
+	}
+
+	return requests
+}
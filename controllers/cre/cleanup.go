@@ -0,0 +1,145 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// reconcileDelete cleans up after a deleted CustomRuntimeEnvironment, unless its retain policy says otherwise,
+// and removes the finalizer once done.
+func (r *CustomRuntimeEnvironmentReconciler) reconcileDelete(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(cre, finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if cre.Spec.RetainPolicy != meteorv1alpha1.RetainPolicyRetain {
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.CleaningUp,
+			Status:             metav1.ConditionTrue,
+			Reason:             "CleaningUp",
+			Message:            "Deleting ImageStreams and workspaces of the builds",
+		})
+
+		if err := r.cleanup(ctx, cre); err != nil {
+			logger.Error(err, "Unable to clean up after CustomRuntimeEnvironment")
+			meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+				ObservedGeneration: cre.Generation,
+				Type:               meteorv1alpha1.ErrorCleaningUp,
+				Status:             metav1.ConditionTrue,
+				Reason:             "ErrorCleaningUp",
+				Message:            err.Error(),
+			})
+			if err := r.Status().Update(ctx, cre); err != nil {
+				logger.Error(err, "Unable to update status")
+			}
+			return ctrl.Result{}, err
+		}
+	} else {
+		logger.Info("Retaining ImageStreams and workspaces of the builds")
+	}
+
+	patch := client.MergeFrom(cre.DeepCopy())
+	controllerutil.RemoveFinalizer(cre, finalizer)
+	return ctrl.Result{}, r.Patch(ctx, cre, patch)
+}
+
+// cleanup deletes the builds and their workspaces in all build backends, and the ImageStreams created by the
+// builds, which are named after them and carry no owner reference.
+func (r *CustomRuntimeEnvironmentReconciler) cleanup(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) error {
+	builds := []string{}
+	for _, backend := range r.Backends {
+		names, err := backend.Cleanup(ctx, cre, nil)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, names...)
+	}
+
+	return r.deleteImageStreams(ctx, cre, imageStreamNames(cre, builds))
+}
+
+// deleteImageStreams deletes the named ImageStreams of the namespace of the CustomRuntimeEnvironment, if the cluster
+// supports them
+func (r *CustomRuntimeEnvironmentReconciler) deleteImageStreams(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, names []string) error {
+	logger := log.FromContext(ctx)
+
+	for _, name := range names {
+		imageStream := &imagev1.ImageStream{}
+		imageStream.Name = name
+		imageStream.Namespace = cre.Namespace
+
+		logger.Info("Deleting ImageStream", "imagestream", name)
+		if err := r.Delete(ctx, imageStream); err != nil {
+			if meta.IsNoMatchError(err) {
+				logger.Info("ImageStreams are not supported by the cluster, skipping their cleanup")
+				break
+			}
+			if !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// imageStreamNames returns the names of the ImageStreams the builds of the CustomRuntimeEnvironment may have created
+func imageStreamNames(cre *meteorv1alpha1.CustomRuntimeEnvironment, builds []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, build := range builds {
+		add(build)
+	}
+	for _, pipeline := range cre.Status.Pipelines {
+		add(pipeline.PipelineRunName)
+	}
+	for _, entry := range cre.Status.BuildHistory {
+		add(entry.PipelineRunName)
+		if entry.Image != nil {
+			add(entry.Image.ImageStreamName)
+		}
+	}
+	if cre.Status.Image != nil {
+		add(cre.Status.Image.ImageStreamName)
+	}
+
+	return names
+}
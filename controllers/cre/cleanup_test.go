@@ -0,0 +1,64 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"reflect"
+	"testing"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestImageStreamNames tests if the ImageStreams of all builds are found, without duplicates
+func TestImageStreamNames(t *testing.T) {
+	testCases := map[string]struct {
+		status         meteorv1alpha1.CustomRuntimeEnvironmentStatus
+		builds         []string
+		expectedOutput []string
+	}{
+		"no-builds": {
+			status:         meteorv1alpha1.CustomRuntimeEnvironmentStatus{},
+			expectedOutput: []string{},
+		},
+		"current-build": {
+			status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{
+				Pipelines: []meteorv1alpha1.PipelineResult{{Name: "package-list", PipelineRunName: "cre-test-2-package-list"}},
+				Image:     &meteorv1alpha1.ImageStatus{ImageStreamName: "cre-test-2-package-list"},
+			},
+			builds:         []string{"cre-test-2-package-list"},
+			expectedOutput: []string{"cre-test-2-package-list"},
+		},
+		"pruned-build": {
+			status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{
+				Pipelines: []meteorv1alpha1.PipelineResult{{Name: "package-list", PipelineRunName: "cre-test-3-package-list"}},
+				BuildHistory: []meteorv1alpha1.BuildHistoryEntry{
+					{Generation: 2, PipelineRunName: "cre-test-2-package-list", Image: &meteorv1alpha1.ImageStatus{ImageStreamName: "cre-test-2-package-list"}},
+					{Generation: 1, PipelineRunName: "cre-test-1-package-list"},
+				},
+			},
+			builds:         []string{"cre-test-3-package-list", "cre-test-2-package-list"},
+			expectedOutput: []string{"cre-test-3-package-list", "cre-test-2-package-list", "cre-test-1-package-list"},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{Status: tc.status}
+		if output := imageStreamNames(cre, tc.builds); !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
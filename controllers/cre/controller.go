@@ -19,9 +19,8 @@ package cre
 import (
 	"context"
 	"fmt"
-	"strconv"
 
-	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	imagev1 "github.com/openshift/api/image/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -30,9 +29,12 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
 )
@@ -41,6 +43,28 @@ import (
 type CustomRuntimeEnvironmentReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader reads objects the controller does not cache, such as the secrets the builds use
+	APIReader client.Reader
+	// Backends are the build backends available, by name
+	Backends map[meteorv1alpha1.BuildBackend]BuildBackend
+	// DefaultBuildBackend runs the builds of CustomRuntimeEnvironments which do not select a build backend
+	DefaultBuildBackend meteorv1alpha1.BuildBackend
+	// Pipelines customizes the Pipelines running the builds and their parameters, by build type
+	Pipelines map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig
+	// Workspace configures the volume the builds work in, unless a CustomRuntimeEnvironment overrides it
+	Workspace meteorv1alpha1.WorkspaceSpec
+	// CABundle holds the CA certificates the builds trust, unless a CustomRuntimeEnvironment overrides it
+	CABundle *meteorv1alpha1.ConfigMapKeyReference
+	// BuildTimeout is the time a build may take, unless a CustomRuntimeEnvironment overrides it
+	BuildTimeout *metav1.Duration
+	// BuildPendingTimeout is the time a build may wait for its first step to start
+	BuildPendingTimeout *metav1.Duration
+	// Concurrency limits the number of builds running at the same time
+	Concurrency meteorv1alpha1.BuildConcurrencyConfig
+
+	queue buildQueue
+	// trackBaseImages is true if the cluster imports the base images into ImageStreams, see baseImageDigest
+	trackBaseImages bool
 }
 
 //+kubebuilder:rbac:groups=meteor.zone,resources=customruntimeenvironments,verbs=get;list;watch;create;update;patch;delete
@@ -49,6 +73,14 @@ type CustomRuntimeEnvironmentReconciler struct {
 //+kubebuilder:rbac:groups=tekton.dev,resources=pipelineruns,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=tekton.dev,resources=pipelineruns/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=tekton.dev,resources=pipelineruns/finalizers,verbs=update
+//+kubebuilder:rbac:groups=tekton.dev,resources=taskruns,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=meteor.zone,resources=runtimeenvironmentcatalogs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=image.openshift.io,resources=imagestreams,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -66,15 +98,45 @@ func (r *CustomRuntimeEnvironmentReconciler) Reconcile(ctx context.Context, req
 	}
 
 	if !CRE.ObjectMeta.DeletionTimestamp.IsZero() {
-		logger.Info("Resource being deleted, skipping further reconcile.")
-		return ctrl.Result{}, nil
+		logger.Info("Resource being deleted, cleaning up.")
+		return r.reconcileDelete(ctx, &CRE)
+	}
+
+	if !controllerutil.ContainsFinalizer(&CRE, finalizer) {
+		patch := client.MergeFrom(CRE.DeepCopy())
+		controllerutil.AddFinalizer(&CRE, finalizer)
+		if err := r.Patch(ctx, &CRE, patch); err != nil {
+			logger.Error(err, "Unable to add finalizer")
+			return ctrl.Result{}, err
+		}
 	}
 	oldStatus := CRE.Status.DeepCopy()
 
+	// the spec has changed since the last build, so the conditions of the previous generation no longer apply
+	if CRE.Status.ObservedGeneration != 0 && CRE.Status.ObservedGeneration != CRE.Generation {
+		logger.Info("Spec changed, archiving build of previous generation", "observedGeneration", CRE.Status.ObservedGeneration, "generation", CRE.Generation)
+		CRE.ArchiveBuild()
+
+		if err := r.cancelBuilds(ctx, &CRE); err != nil {
+			logger.Error(err, "Unable to cancel builds of previous generations")
+		}
+	}
+
 	CRE.Status.Phase = CRE.AggregatePhase()
 
-	// depending on the build type, we reconcile a pipelinerun
-	r.reconcilePipelineRun(ctx, &CRE)
+	// the rebuild schedule and the updates of the base image start a new build of the current generation
+	scheduleWait := r.reconcileSchedule(ctx, &CRE)
+	r.reconcileBaseImage(ctx, &CRE)
+
+	// depending on the build type, we reconcile a build
+	result, handled := r.reconcileBuild(ctx, &CRE)
+	if scheduleWait > 0 && (result.RequeueAfter == 0 || scheduleWait < result.RequeueAfter) {
+		result.RequeueAfter = scheduleWait
+	}
+
+	if err := r.pruneBuilds(ctx, &CRE); err != nil {
+		logger.Error(err, "Unable to prune builds of previous generations")
+	}
 
 	// let's see if we can update the status
 	CRE.Status.ObservedGeneration = CRE.Generation
@@ -83,42 +145,80 @@ func (r *CustomRuntimeEnvironmentReconciler) Reconcile(ctx context.Context, req
 		CRE.Status.Phase = CRE.AggregatePhase()
 	}
 
-	err := r.Status().Update(ctx, &CRE)
-	return ctrl.Result{}, err
+	if err := r.Status().Update(ctx, &CRE); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the force-rebuild annotation only applies to the spec change it was set along with, if any, and the
+	// annotations requesting an action on the build are done once it has been handled
+	if _, ok := CRE.Annotations[meteorv1alpha1.CREForceRebuildAnnotationKey]; ok {
+		handled = append(handled, meteorv1alpha1.CREForceRebuildAnnotationKey)
+	}
+	if len(handled) > 0 {
+		patch := client.MergeFrom(CRE.DeepCopy())
+		for _, key := range handled {
+			delete(CRE.Annotations, key)
+		}
+		if err := r.Patch(ctx, &CRE, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CustomRuntimeEnvironmentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	// TODO setup index for PipelineRuns
-
-	return ctrl.NewControllerManagedBy(mgr).
+	bldr := ctrl.NewControllerManagedBy(mgr).
 		For(&meteorv1alpha1.CustomRuntimeEnvironment{}).
-		Owns(&pipelinev1beta1.PipelineRun{}).
 		Owns(&meteorv1alpha1.Meteor{}).
-		Complete(r)
+		Owns(&v1.ConfigMap{}).
+		Watches(&source.Kind{Type: &meteorv1alpha1.RuntimeEnvironmentCatalog{}}, handler.EnqueueRequestsFromMapFunc(r.unresolvedCustomRuntimeEnvironments)).
+		Watches(&source.Kind{Type: &v1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.secretMissingCustomRuntimeEnvironments), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &v1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.buildFileMissingCustomRuntimeEnvironments)).
+		Watches(&source.Kind{Type: &meteorv1alpha1.CustomRuntimeEnvironment{}}, handler.EnqueueRequestsFromMapFunc(r.queuedCustomRuntimeEnvironments))
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &meteorv1alpha1.CustomRuntimeEnvironment{}, buildCacheKeyField, indexBuildCacheKey); err != nil {
+		return err
+	}
+
+	gvk := imagev1.GroupVersion.WithKind("ImageStream")
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		ctrl.Log.WithName("setup").Info("ImageStreams are not supported by the cluster, updates of base images are not tracked")
+	} else {
+		r.trackBaseImages = true
+		bldr.Owns(&imagev1.ImageStream{})
+	}
+
+	for _, backend := range r.Backends {
+		if err := backend.SetupWithManager(mgr, bldr); err != nil {
+			return err
+		}
+	}
+
+	return bldr.Complete(r)
 }
 
-// reconcilePipelineRun will reconcile the pipeline run for the CustomRuntimeEnvironment.
-func (r *CustomRuntimeEnvironmentReconciler) reconcilePipelineRun(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) {
+// reconcileBuild will reconcile the build of the CustomRuntimeEnvironment, run by its build backend. It returns when
+// to reconcile again, and the annotations requesting an action on the build which have been handled.
+func (r *CustomRuntimeEnvironmentReconciler) reconcileBuild(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) (ctrl.Result, []string) {
 
 	build_types := map[meteorv1alpha1.BuildType]string{
-		meteorv1alpha1.GitRepository: "gitrepo",
-		meteorv1alpha1.PackageList:   "package-list",
-		meteorv1alpha1.ImportImage:   "import",
+		meteorv1alpha1.GitRepository:    "gitrepo",
+		meteorv1alpha1.PackageList:      "package-list",
+		meteorv1alpha1.ImportImage:      "import",
+		meteorv1alpha1.CondaEnvironment: "conda-environment",
+		meteorv1alpha1.Pipenv:           "pipenv",
+		meteorv1alpha1.Containerfile:    "containerfile",
 	}
 
 	pipeline := build_types[cre.Spec.BuildType]
-	pipelineRun := &pipelinev1beta1.PipelineRun{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("cre-%s-%d-%s", cre.GetName(), cre.GetGeneration(), pipeline),
-			Namespace: cre.Namespace,
-			Labels: map[string]string{
-				"cre.thoth-station.ninja/pipeline":         build_types[cre.Spec.BuildType],
-				"cre.thoth-station.ninja/spouseGeneration": strconv.FormatInt(cre.GetGeneration(), 10),
-			}}}
-	namespacedName := types.NamespacedName{Name: pipelineRun.GetName(), Namespace: cre.Namespace}
-
-	logger := log.FromContext(ctx).WithValues("pipelinerun", namespacedName)
+	name := buildName(cre, pipeline)
+
+	logger := log.FromContext(ctx).WithValues("build", types.NamespacedName{Name: name, Namespace: cre.Namespace})
 
 	statusIndex := func() int {
 		for i, pr := range cre.Status.Pipelines {
@@ -129,245 +229,408 @@ func (r *CustomRuntimeEnvironmentReconciler) reconcilePipelineRun(ctx context.Co
 		result := meteorv1alpha1.PipelineResult{
 			Name:            cre.Name,
 			Ready:           "False",
-			PipelineRunName: pipelineRun.GetName(),
+			PipelineRunName: name,
 		}
 		cre.Status.Pipelines = append(cre.Status.Pipelines, result)
 		return len(cre.Status.Pipelines) - 1
 	}()
 
-	if err := r.Get(ctx, namespacedName, pipelineRun); err != nil {
-		if errors.IsNotFound(err) {
-			logger.Info("Creating PipelineRun")
-
-			// let's put the mandatory annotations into the PipelineRun
-			params := []pipelinev1beta1.Param{
-				{
-					Name: "name",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-name"],
-					},
-				},
-				{
-					Name: "creator",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-creator"],
-					},
-				},
-				{
-					Name: "description",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-desc"],
-					},
-				},
-			}
+	backend, err := r.backend(cre)
+	if err != nil {
+		logger.Error(err, "Unable to select build backend")
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.BuildBackendUnavailable,
+			Status:             metav1.ConditionTrue,
+			Reason:             "BuildBackendUnavailable",
+			Message:            err.Error(),
+		})
+		return ctrl.Result{RequeueAfter: unavailableBackendRequeueAfter}, nil
+	}
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.BuildBackendUnavailable)
 
-			// Add the parameters specific to each build type
-			switch buildType := cre.Spec.BuildTypeSpec.BuildType; buildType {
-			case meteorv1alpha1.ImportImage:
-				params = append(params, pipelinev1beta1.Param{
-					Name: "baseImage",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.Spec.BuildTypeSpec.FromImage,
-					}, // TODO we need a validator for this
-				})
-			case meteorv1alpha1.PackageList:
-				// if we have a BaseImage supplied, use it
-				if cre.Spec.BaseImage != "" {
-					params = append(params, pipelinev1beta1.Param{
-						Name: "baseImage",
-						Value: pipelinev1beta1.ArrayOrString{
-							Type:      pipelinev1beta1.ParamTypeString,
-							StringVal: cre.Spec.BaseImage,
-						},
-					})
-				} else {
-					params = append(params, pipelinev1beta1.Param{
-						Name: "osVersion",
-						Value: pipelinev1beta1.ArrayOrString{
-							Type:      pipelinev1beta1.ParamTypeString,
-							StringVal: cre.Spec.RuntimeEnvironment.OSVersion,
-						},
-					}, pipelinev1beta1.Param{
-						Name: "osName",
-						Value: pipelinev1beta1.ArrayOrString{
-							Type:      pipelinev1beta1.ParamTypeString,
-							StringVal: cre.Spec.RuntimeEnvironment.OSName,
-						},
-					}, pipelinev1beta1.Param{
-						Name: "pythonVersion",
-						Value: pipelinev1beta1.ArrayOrString{
-							Type:      pipelinev1beta1.ParamTypeString,
-							StringVal: cre.Spec.RuntimeEnvironment.PythonVersion,
-						},
-					})
-				}
-
-				// if we have no PackageVersion specified, we are done...
-				if len(cre.Spec.PackageVersions) > 0 {
-					params = append(params, pipelinev1beta1.Param{
-						Name: "packages",
-						Value: pipelinev1beta1.ArrayOrString{
-							Type:     pipelinev1beta1.ParamTypeArray,
-							ArrayVal: cre.Spec.PackageVersions,
-						},
-					})
-				}
-			case meteorv1alpha1.GitRepository:
-				params = append(params, pipelinev1beta1.Param{
-					Name: "url",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.Spec.BuildTypeSpec.Repository,
-					},
-				}, pipelinev1beta1.Param{
-					Name: "ref",
-					Value: pipelinev1beta1.ArrayOrString{
-						Type:      pipelinev1beta1.ParamTypeString,
-						StringVal: cre.Spec.BuildTypeSpec.GitRef,
-					},
+	build, err := backend.Status(ctx, cre, name)
+	if err != nil {
+		logger.Error(err, "Error fetching build")
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.GenericPipelineError,
+			Status:             metav1.ConditionTrue,
+			Reason:             "PipelineRunGenericError",
+			Message:            err.Error()},
+		)
+		return ctrl.Result{}, nil
+	}
+
+	handled := []string{}
+	_, cancel := cre.Annotations[meteorv1alpha1.CRECancelAnnotationKey]
+	_, retry := cre.Annotations[meteorv1alpha1.CRERetryAnnotationKey]
+
+	// the cancel annotation is handled once the build has stopped, a build not submitted yet is not submitted at all
+	if cancel {
+		if build != nil && build.State == BuildRunning {
+			logger.Info("Cancelling build")
+			if err := backend.Cancel(ctx, cre, nil); err != nil {
+				logger.Error(err, "Unable to cancel build")
+				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+					ObservedGeneration: cre.Generation,
+					Type:               meteorv1alpha1.GenericPipelineError,
+					Status:             metav1.ConditionTrue,
+					Reason:             "PipelineRunCancelFailed",
+					Message:            err.Error(),
 				})
 			}
+			return ctrl.Result{}, nil
+		}
 
-			pipelineRun = &pipelinev1beta1.PipelineRun{
-				ObjectMeta: pipelineRun.ObjectMeta,
-				Spec: pipelinev1beta1.PipelineRunSpec{
-					PipelineRef: &pipelinev1beta1.PipelineRef{
-						Name: fmt.Sprintf("cre-%s", pipeline),
-					},
-					Params:     params,
-					Workspaces: workspaces_const,
-				},
-			}
-			controllerutil.SetControllerReference(cre, pipelineRun, r.Scheme)
-
-			if err := r.Create(ctx, pipelineRun); err != nil {
-				logger.Error(err, "Unable to create PipelineRun")
-
-				meta.SetStatusCondition(&cre.Status.Conditions,
-					metav1.Condition{
-						ObservedGeneration: cre.Generation,
-						Type:               meteorv1alpha1.ErrorPipelineRunCreate,
-						Status:             metav1.ConditionTrue,
-						Reason:             "PipelineRunCreateFailed",
-						Message:            err.Error(),
-					})
-			}
-			logger.Info("Created PipelineRun for CNBI", "PipelineRun", pipelineRun.GetNamespacedName(), "CRE", cre)
+		handled = append(handled, meteorv1alpha1.CRECancelAnnotationKey)
+		if build == nil {
+			logger.Info("Build cancelled before it was submitted")
+			setBuildCancelled(cre, statusIndex)
+			return ctrl.Result{}, handled
+		}
+	}
+
+	if build == nil {
+		if meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.BuildCancelled) && !retry {
+			return ctrl.Result{}, handled
+		}
+		// the image reused from the build cache has no build of its own, it is only built on request or by a rebuild
+		if isCacheHit(cre) && !retry {
+			return ctrl.Result{}, handled
+		}
+		params, ok := r.buildParams(ctx, cre)
+		if !ok {
+			return ctrl.Result{}, handled
+		}
+		// the rebuilds are meant to pick up the fixes the cached image misses
+		key := buildCacheKey(cre.Spec.BuildType, r.Pipelines[cre.Spec.BuildType].PipelineRef, params, cre.Status.BuildBaseImageDigest)
+		cacheable := key != "" && !cre.Spec.NoCache && !retry && cre.Status.Rebuilds == 0
+		if cacheable && r.reuseCachedImage(ctx, cre, name, key, statusIndex) {
+			return ctrl.Result{}, handled
+		}
+		if !r.admitBuild(ctx, cre) {
+			return ctrl.Result{RequeueAfter: queuedBuildRequeueAfter}, handled
+		}
+		if r.submitBuild(ctx, cre, backend, name, pipeline, params, key) && retry {
+			handled = append(handled, meteorv1alpha1.CRERetryAnnotationKey)
+		}
+		return ctrl.Result{}, handled
+	}
+
+	// Let's check if the build is completed successfully or not, and conclude our new conditions
+	switch build.State {
+	case BuildRunning:
+		return r.watchBuild(ctx, cre, backend, build, statusIndex), handled
+	case BuildSucceeded:
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.PipelineRunCompleted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "PipelineRunCompleted",
+			Message:            "The PipelineRun has been completed successfully.",
+		})
+		meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
+		cre.Status.Failure = nil
+
+		cre.Status.Image = imageStatusFromBuild(cre, build)
+		cre.Status.Image.CacheKey = cre.Status.BuildCacheKey
+		cre.Status.Image.BaseImageDigest = cre.Status.BuildBaseImageDigest
+		if cre.Status.Image.BaseImage == "" && cre.Spec.BuildType.BuildsOnBaseImage() {
+			cre.Status.Image.BaseImage = trackedBaseImage(cre)
+		}
+		cre.Status.Pipelines[statusIndex].Ready = "True"
+		cre.Status.Pipelines[statusIndex].Url = cre.Status.Image.PullSpec
+
+		if condition, ok := meteorv1alpha1.BuildConditions[cre.Spec.BuildType]; ok {
 			meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
 				ObservedGeneration: cre.Generation,
-				Type:               meteorv1alpha1.PipelineRunCreated,
+				Type:               condition.Type,
 				Status:             metav1.ConditionTrue,
-				Reason:             "PipelineRunCreated",
-				Message:            fmt.Sprintf("%s PipelineRun created successfully", pipelineRun.Name),
+				Reason:             condition.SucceededReason,
+				Message:            condition.SucceededMessage,
 			})
-			return
 		}
-
-		logger.Error(err, "Error fetching PipelineRun")
+		if cre.Spec.BuildType == meteorv1alpha1.PackageList {
+			r.reconcileLock(ctx, cre, build.Name)
+		}
+	case BuildFailed:
 		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
 			ObservedGeneration: cre.Generation,
-			Type:               meteorv1alpha1.GenericPipelineError,
+			Type:               meteorv1alpha1.PipelineRunCompleted,
 			Status:             metav1.ConditionTrue,
-			Reason:             "PipelineRunGenericError",
-			Message:            err.Error()},
-		)
-		return
-	}
+			Reason:             "PipelineRunCompleted",
+			Message:            "The PipelineRun has been completed with a failure!",
+		})
+		meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
 
-	if len(pipelineRun.Status.Conditions) > 0 {
-		if len(pipelineRun.Status.Conditions) != 1 { // TODO observe tekton project if they stay with just one condition all the time
-			logger.Error(nil, "Tekton reported multiple conditions")
+		if condition, ok := meteorv1alpha1.BuildConditions[cre.Spec.BuildType]; ok {
+			meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+				ObservedGeneration: cre.Generation,
+				Type:               condition.Type,
+				Status:             metav1.ConditionFalse,
+				Reason:             condition.FailedReason,
+				Message:            condition.FailedMessage,
+			})
 		}
 
-		// Let's check if the PipelineRun is completed successfully or not, and conclude our new conditions
-		if pipelineRun.Status.Conditions[0].Status == v1.ConditionTrue && pipelineRun.Status.Conditions[0].Type == "Succeeded" {
+		cre.Status.Pipelines[statusIndex].Ready = "False"
+		r.reconcileFailure(cre, build)
+		if build.TimedOut {
 			meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
 				ObservedGeneration: cre.Generation,
-				Type:               meteorv1alpha1.PipelineRunCompleted,
+				Type:               meteorv1alpha1.BuildTimedOut,
 				Status:             metav1.ConditionTrue,
-				Reason:             "PipelineRunCompleted",
-				Message:            "The PipelineRun has been completed successfully.",
+				Reason:             "BuildTimeout",
+				Message:            fmt.Sprintf("The build has run longer than its build timeout of %s.", r.buildTimeout(cre)),
 			})
-			meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
+		}
+	case BuildCancelled:
+		// the builds which timed out have been cancelled by watchBuild
+		if !meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.BuildTimedOut) {
+			setBuildCancelled(cre, statusIndex)
+		}
+	}
 
-			if pipelineRun.Labels["cre.thoth-station.ninja/pipeline"] == "import" {
-				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
-					ObservedGeneration: cre.Generation,
-					Type:               meteorv1alpha1.ImageImportReady,
-					Status:             metav1.ConditionTrue,
-					Reason:             "ImageImportReady",
-					Message:            "Import succeeded, the image is ready to be used.",
-				})
-			}
-			if pipelineRun.Labels["cre.thoth-station.ninja/pipeline"] == "package-list" {
-				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
-					ObservedGeneration: cre.Generation,
-					Type:               meteorv1alpha1.PackageListBuildCompleted,
-					Status:             metav1.ConditionTrue,
-					Reason:             "PackageListBuildCompleted",
-					Message:            "Build from Package List succeeded, the image is ready to be used.",
-				})
-			}
+	// the finished build is built again on request, or if the retry policy retries its failure
+	retryNow, wait := retryAfter(cre, build, retry)
+	if !retryNow {
+		return ctrl.Result{}, handled
+	}
+	if wait > 0 {
+		logger.Info("Retrying failed build after backoff", "backoff", wait, "retries", cre.Status.Retries)
+		return ctrl.Result{RequeueAfter: wait}, handled
+	}
 
-			// TODO add other pipeline-specific success conditions
-		} else if pipelineRun.Status.Conditions[0].Status == v1.ConditionFalse && pipelineRun.Status.Conditions[0].Type == "Succeeded" {
-			meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+	cre.RetryBuild()
+	name = buildName(cre, pipeline)
+	cre.Status.Pipelines[statusIndex] = meteorv1alpha1.PipelineResult{
+		Name:            cre.Name,
+		Ready:           "False",
+		PipelineRunName: name,
+	}
+	logger.Info("Retrying build", "retry", name, "retries", cre.Status.Retries)
+	// a reconciliation which failed to update the status may have submitted the retried build already
+	if retried, err := backend.Status(ctx, cre, name); err == nil && retried != nil {
+		if retry {
+			handled = append(handled, meteorv1alpha1.CRERetryAnnotationKey)
+		}
+		return ctrl.Result{}, handled
+	}
+	params, ok := r.buildParams(ctx, cre)
+	if !ok {
+		return ctrl.Result{}, handled
+	}
+	if !r.admitBuild(ctx, cre) {
+		return ctrl.Result{RequeueAfter: queuedBuildRequeueAfter}, handled
+	}
+	key := buildCacheKey(cre.Spec.BuildType, r.Pipelines[cre.Spec.BuildType].PipelineRef, params, cre.Status.BuildBaseImageDigest)
+	if r.submitBuild(ctx, cre, backend, name, pipeline, params, key) && retry {
+		handled = append(handled, meteorv1alpha1.CRERetryAnnotationKey)
+	}
+
+	return ctrl.Result{}, handled
+}
+
+// submitBuild submits the named build of the current generation of the CustomRuntimeEnvironment with the given
+// parameters, whose content hash is the cache key of the image it builds. It returns false if the build could not be
+// submitted, the conditions record why then.
+func (r *CustomRuntimeEnvironmentReconciler) submitBuild(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, backend BuildBackend, name, pipeline string, params []BuildParam, key string) bool {
+	logger := log.FromContext(ctx).WithValues("build", types.NamespacedName{Name: name, Namespace: cre.Namespace})
+
+	// the slot admitted to the build is given back unless the build is submitted
+	submitted := false
+	defer func() {
+		if !submitted {
+			r.queue.release(types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name})
+		}
+	}()
+
+	gitSecret, imagePullSecret, ok := r.buildSecrets(ctx, cre)
+	if !ok {
+		return false
+	}
+
+	logger.Info("Submitting build")
+	request := &BuildRequest{
+		Name:            name,
+		Pipeline:        pipeline,
+		Params:          params,
+		Workspace:       r.buildWorkspace(cre),
+		CABundle:        r.buildCABundle(cre),
+		GitSecret:       gitSecret,
+		ImagePullSecret: imagePullSecret,
+		Timeout:         r.buildTimeout(cre),
+	}
+	if err := backend.Submit(ctx, cre, request); err != nil {
+		logger.Error(err, "Unable to submit build")
+
+		meta.SetStatusCondition(&cre.Status.Conditions,
+			metav1.Condition{
 				ObservedGeneration: cre.Generation,
-				Type:               meteorv1alpha1.PipelineRunCompleted,
+				Type:               meteorv1alpha1.ErrorPipelineRunCreate,
 				Status:             metav1.ConditionTrue,
-				Reason:             "PipelineRunCompleted",
-				Message:            "The PipelineRun has been completed with a failure!",
+				Reason:             "PipelineRunCreateFailed",
+				Message:            err.Error(),
 			})
-			meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
+		return false
+	}
+	logger.Info("Submitted build for CNBI", "CRE", cre)
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.ErrorPipelineRunCreate)
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.BuildCancelled)
+	if meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.CacheHit) {
+		meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.CacheHit)
+		meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCompleted)
+	}
+	cre.Status.BuildCacheKey = key
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.PipelineRunCreated,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PipelineRunCreated",
+		Message:            fmt.Sprintf("%s PipelineRun created successfully", name),
+	})
+	submitted = true
+	return true
+}
 
-			if pipelineRun.Labels["cre.thoth-station.ninja/pipeline"] == "import" {
-				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
-					ObservedGeneration: cre.Generation,
-					Type:               meteorv1alpha1.ImageImportReady,
-					Status:             metav1.ConditionFalse,
-					Reason:             "ImageImportNotReady",
-					Message:            "Import failed, this could be due to the repository to import from does not exist or is not accessible",
-				})
-			} else if pipelineRun.Labels["cre.thoth-station.ninja/pipeline"] == "gitrepo" {
+// setBuildCancelled records that the build of the current generation has been cancelled
+func setBuildCancelled(cre *meteorv1alpha1.CustomRuntimeEnvironment, statusIndex int) {
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.BuildCancelled,
+		Status:             metav1.ConditionTrue,
+		Reason:             "BuildCancelled",
+		Message:            fmt.Sprintf("The build has been cancelled by the %s annotation.", meteorv1alpha1.CRECancelAnnotationKey),
+	})
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.PipelineRunCompleted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PipelineRunCancelled",
+		Message:            "The PipelineRun has been cancelled.",
+	})
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
+	cre.Status.Pipelines[statusIndex].Ready = "False"
+}
+
+// buildParams returns the parameters of the build of the CustomRuntimeEnvironment, false if they are
+// not available yet, the reason is recorded in the conditions then.
+func (r *CustomRuntimeEnvironmentReconciler) buildParams(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) ([]BuildParam, bool) {
+	logger := log.FromContext(ctx)
+
+	// let's put the mandatory annotations into the build
+	params := []BuildParam{
+		{Name: "name", Value: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-name"]},
+		{Name: "creator", Value: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-creator"]},
+		{Name: "description", Value: cre.ObjectMeta.Annotations["opendatahub.io/notebook-image-desc"]},
+	}
+
+	// the build types installing packages on a base image use the given one, or the one the runtime environment resolves to
+	if cre.Spec.BuildType.BuildsOnBaseImage() {
+		baseImage := cre.Spec.BaseImage
+		if baseImage == "" {
+			resolved, err := r.resolveBaseImage(ctx, cre)
+			if err != nil {
+				logger.Error(err, "Unable to resolve base image")
 				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
 					ObservedGeneration: cre.Generation,
-					Type:               meteorv1alpha1.ErrorBuildingImage,
+					Type:               meteorv1alpha1.ErrorResolvingBaseImage,
 					Status:             metav1.ConditionTrue,
-					Reason:             "ErrorBuildingImage",
-					Message:            "Build failed!",
-				})
-			} else if pipelineRun.Labels["cre.thoth-station.ninja/pipeline"] == "package-list" {
-				meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
-					ObservedGeneration: cre.Generation,
-					Type:               meteorv1alpha1.PackageListBuildCompleted,
-					Status:             metav1.ConditionFalse,
-					Reason:             "PackageListBuildCompleted",
-					Message:            "Build from Package List failed!",
+					Reason:             "RuntimeEnvironmentNotInCatalog",
+					Message:            err.Error(),
 				})
+				return nil, false
 			}
+			cre.Status.ResolvedBaseImage = resolved
+			baseImage = resolved
+		}
 
+		params = append(params, BuildParam{Name: "baseImage", Value: r.pinBaseImage(ctx, cre, baseImage)})
+	}
+	// the base image resolved, or the spec no longer needs it resolved
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.ErrorResolvingBaseImage)
+
+	// Add the parameters specific to each build type
+	switch buildType := cre.Spec.BuildTypeSpec.BuildType; buildType {
+	case meteorv1alpha1.ImportImage:
+		params = append(params, BuildParam{Name: "baseImage", Value: cre.Spec.BuildTypeSpec.FromImage})
+	case meteorv1alpha1.PackageList:
+		// if we have no PackageVersion specified, we are done...
+		if len(cre.Spec.PackageVersions) > 0 {
+			params = append(params, BuildParam{Name: "packages", Values: cre.Spec.PackageVersions})
 		}
 
-		return
+		// reuse the pinned requirements of the previous build, if the CRE is locked
+		lockedRequirements, err := r.lockedRequirements(ctx, cre)
+		if err != nil {
+			logger.Error(err, "Unable to fetch pinned requirements, resolving packages again")
+		}
+		if lockedRequirements != "" {
+			params = append(params, BuildParam{Name: "lockedRequirements", Value: lockedRequirements})
+		}
+	case meteorv1alpha1.GitRepository:
+		// the build picks its base image itself, the one of the previous build is expected
+		r.pinBaseImage(ctx, cre, trackedBaseImage(cre))
+		params = append(params,
+			BuildParam{Name: "url", Value: cre.Spec.BuildTypeSpec.Repository},
+			BuildParam{Name: "ref", Value: cre.Spec.BuildTypeSpec.GitRef},
+		)
+	case meteorv1alpha1.CondaEnvironment:
+		environmentFile, err := r.fileContent(ctx, cre, cre.Spec.EnvironmentFile)
+		if err != nil {
+			r.setBuildFileUnavailable(ctx, cre, err)
+			return nil, false
+		}
 
-	}
+		params = append(params, BuildParam{Name: "environmentFile", Value: environmentFile})
+	case meteorv1alpha1.Pipenv:
+		pipfile, err := r.fileContent(ctx, cre, cre.Spec.Pipfile)
+		if err != nil {
+			r.setBuildFileUnavailable(ctx, cre, err)
+			return nil, false
+		}
+		pipfileLock, err := r.fileContent(ctx, cre, cre.Spec.PipfileLock)
+		if err != nil {
+			r.setBuildFileUnavailable(ctx, cre, err)
+			return nil, false
+		}
 
-	if pipelineRun.Status.CompletionTime != nil {
-		if pipelineRun.Status.Conditions[0].Reason == "Succeeded" { // FIXME this feels dangerous, is it really the 1st one? all the time?
-			cre.Status.Pipelines[statusIndex].Ready = "True"
-			if len(pipelineRun.Status.PipelineResults) > 0 {
-				if pipelineRun.Status.PipelineResults[0].Value.Type == pipelinev1beta1.ParamTypeString {
-					cre.Status.Pipelines[statusIndex].Url = pipelineRun.Status.PipelineResults[0].Value.StringVal
-				}
-			}
-		} else if pipelineRun.Status.Conditions[0].Reason == "Failed" {
-			cre.Status.Pipelines[statusIndex].Ready = "False"
+		params = append(params,
+			BuildParam{Name: "pipfile", Value: pipfile},
+			BuildParam{Name: "pipfileLock", Value: pipfileLock},
+		)
+	case meteorv1alpha1.Containerfile:
+		containerfile, err := r.fileContent(ctx, cre, cre.Spec.Containerfile)
+		if err != nil {
+			r.setBuildFileUnavailable(ctx, cre, err)
+			return nil, false
 		}
+
+		params = append(params,
+			BuildParam{Name: "url", Value: cre.Spec.BuildTypeSpec.Repository},
+			BuildParam{Name: "ref", Value: cre.Spec.BuildTypeSpec.GitRef},
+			BuildParam{Name: "contextDir", Value: cre.Spec.BuildTypeSpec.ContextDir},
+			BuildParam{Name: "containerfilePath", Value: cre.Spec.BuildTypeSpec.ContainerfilePath},
+			BuildParam{Name: "containerfile", Value: containerfile},
+		)
+	}
+	// the files used for building are available, or the spec no longer references them
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.BuildFileUnavailable)
+
+	params, err := applyParamTemplates(cre, params, r.Pipelines[cre.Spec.BuildType].Params)
+	if err != nil {
+		logger.Error(err, "Unable to evaluate parameter templates")
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.ErrorEvaluatingParamTemplate,
+			Status:             metav1.ConditionTrue,
+			Reason:             "InvalidParamTemplate",
+			Message:            err.Error(),
+		})
+		return nil, false
 	}
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.ErrorEvaluatingParamTemplate)
 
-	return
+	return params, true
 }
@@ -18,38 +18,47 @@ limitations under the License.
 
 package cre
 
-import (
-	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/utils/pointer"
+const (
+	// pipelineLabelKey is the label on a build carrying the name of the pipeline used for the build type
+	pipelineLabelKey = "cre.thoth-station.ninja/pipeline"
+	// generationLabelKey is the label on a build carrying the generation of the CustomRuntimeEnvironment it builds
+	generationLabelKey = "cre.thoth-station.ninja/spouseGeneration"
+	// buildLabelKey is the label on the workspace PersistentVolumeClaim of a build carrying the name of the build
+	buildLabelKey = "cre.thoth-station.ninja/build"
+
+	// buildOwnerKey is the field index of builds, PipelineRuns or Jobs, by the name of their controlling CustomRuntimeEnvironment
+	buildOwnerKey = ".metadata.controller"
+
+	// buildCacheKeyField is the field index of CustomRuntimeEnvironments by the content hash of the inputs their image
+	// was built from
+	buildCacheKeyField = ".status.image.cacheKey"
+
+	// finalizer is the finalizer cleaning up the ImageStreams and workspaces of a deleted CustomRuntimeEnvironment
+	finalizer = "meteor.zone/finalizer"
+)
+
+// names of the results our pipelines report about the image they produced
+const (
+	imageURLResult        = "IMAGE_URL"
+	imageDigestResult     = "IMAGE_DIGEST"
+	imageStreamNameResult = "IMAGESTREAM_NAME"
+	imageStreamTagResult  = "IMAGESTREAM_TAG"
+	baseImageResult       = "BASE_IMAGE"
+)
+
+// defaults of the workspace and the CA bundle of the builds
+const (
+	defaultWorkspaceSize     = "500Mi"
+	defaultCABundleConfigMap = "openshift-service-ca.crt"
+	defaultCABundleKey       = "service-ca.crt"
+)
+
+// defaults of the Job build backend, the registry is the OpenShift internal one and only used on OpenShift
+const (
+	defaultJobBuilderImage = "quay.io/buildah/stable:v1.27.0"
+	defaultJobRegistry     = "image-registry.openshift-image-registry.svc:5000"
+	jobGitImage            = "docker.io/alpine/git:v2.36.2"
 )
 
-var workspaces_const = []pipelinev1beta1.WorkspaceBinding{
-	{
-		Name: "data",
-		VolumeClaimTemplate: &v1.PersistentVolumeClaim{
-			Spec: v1.PersistentVolumeClaimSpec{
-				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
-				Resources: v1.ResourceRequirements{
-					Requests: v1.ResourceList{
-						v1.ResourceStorage: resource.MustParse("500Mi"),
-					},
-				},
-			},
-		},
-	},
-	{
-		Name: "sslcertdir",
-		ConfigMap: &v1.ConfigMapVolumeSource{
-			LocalObjectReference: v1.LocalObjectReference{
-				Name: "openshift-service-ca.crt",
-			},
-			Items: []v1.KeyToPath{{
-				Key:  "service-ca.crt",
-				Path: "ca.crt",
-			}},
-			DefaultMode: pointer.Int32(420),
-		},
-	},
-}
+// lockRequirementsKey is the key of the pinned requirements in the lock ConfigMaps
+const lockRequirementsKey = "requirements.txt"
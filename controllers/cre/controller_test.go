@@ -23,6 +23,9 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -45,6 +48,23 @@ var _ = Describe("CustomRuntimeEnvironment controller", func() {
 		packages := []string{"numpy", "pandas", "scikit-learn"}
 
 		It("should be in Phase 'Running'", func() {
+			By("creating a RuntimeEnvironmentCatalog object")
+			catalog := &meteorv1alpha1.RuntimeEnvironmentCatalog{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "RuntimeEnvironmentCatalog"},
+				ObjectMeta: metav1.ObjectMeta{Name: "default"},
+				Spec: meteorv1alpha1.RuntimeEnvironmentCatalogSpec{
+					RuntimeEnvironments: []meteorv1alpha1.CatalogRuntimeEnvironment{
+						{
+							PythonVersion: uni8py38.PythonVersion,
+							OSName:        uni8py38.OSName,
+							OSVersion:     uni8py38.OSVersion,
+							BaseImage:     "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), catalog)).Should(Succeed())
+
 			By("creating a CustomRuntimeEnvironment object")
 			build := meteorv1alpha1.BuildTypeSpec{
 				BuildType: meteorv1alpha1.PackageList,
@@ -70,9 +90,184 @@ var _ = Describe("CustomRuntimeEnvironment controller", func() {
 					g.Expect(err).NotTo(HaveOccurred())
 					g.Expect(createdCRE.Status.Conditions).ToNot(BeEmpty())
 					g.Expect(createdCRE.Status.Phase).To(Equal(meteorv1alpha1.PhaseRunning))
+					g.Expect(createdCRE.Status.ResolvedBaseImage).To(Equal("quay.io/thoth-station/s2i-custom-py38-notebook:latest"))
 				}, "8s", "500ms").Should(Succeed())
 			}, timeout, interval).Should(Succeed())
 
 		})
+
+		It("should have a finalizer and be removed after deletion", func() {
+			lookupKey := types.NamespacedName{Name: "test-1", Namespace: "default"}
+
+			createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+			Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+			Expect(createdCRE.Finalizers).Should(ContainElement(finalizer))
+
+			Expect(k8sClient.Delete(ctx, createdCRE)).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, lookupKey, createdCRE)
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when a CustomRuntimeEnvironment object is created with a RuntimeEnvironment missing from the catalogs", func() {
+		It("should be in Phase 'Failed'", func() {
+			By("creating a CustomRuntimeEnvironment object")
+			cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-2", Namespace: "default"},
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					RuntimeEnvironment: meteorv1alpha1.CustomRuntimeEnvironmentRuntimeSpec{
+						PythonVersion: "3.6",
+						OSName:        "fedora",
+						OSVersion:     "35",
+					},
+					PackageVersions: []string{"numpy"},
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+						BuildType: meteorv1alpha1.PackageList,
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: "test-2", Namespace: "default"}
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.ErrorResolvingBaseImage)).To(BeTrue())
+				g.Expect(createdCRE.Status.Phase).To(Equal(meteorv1alpha1.PhaseFailed))
+				g.Expect(createdCRE.Status.ResolvedBaseImage).To(BeEmpty())
+			}, timeout, interval).Should(Succeed())
+		})
+	})
+
+	Context("when a CustomRuntimeEnvironment object is created with a gitSecret which does not exist", func() {
+		It("should build once the secret is created", func() {
+			By("creating a CustomRuntimeEnvironment object")
+			cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-3", Namespace: "default"},
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+						BuildType:     meteorv1alpha1.Containerfile,
+						Repository:    "git@github.com:thoth-station/s2i-custom-notebook.git",
+						GitRef:        "HEAD",
+						GitSecret:     &meteorv1alpha1.GitSecret{Name: "test-3-git"},
+						Containerfile: &meteorv1alpha1.FileSource{Content: "FROM quay.io/thoth-station/s2i-custom-notebook:latest"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: "test-3", Namespace: "default"}
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.RequiredSecretMissing)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.PipelineRunCreated)).To(BeFalse())
+			}, timeout, interval).Should(Succeed())
+
+			By("creating the secret")
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-3-git", Namespace: "default"},
+				Type:       v1.SecretTypeSSHAuth,
+				StringData: map[string]string{v1.SSHAuthPrivateKey: "not a key"},
+			}
+			Expect(k8sClient.Create(context.Background(), secret)).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(meta.FindStatusCondition(createdCRE.Status.Conditions, meteorv1alpha1.RequiredSecretMissing)).To(BeNil())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.PipelineRunCreated)).To(BeTrue())
+			}, timeout, interval).Should(Succeed())
+		})
+	})
+
+	Context("when a CustomRuntimeEnvironment object is created with a Containerfile in a ConfigMap which does not exist", func() {
+		It("should build once the ConfigMap is created", func() {
+			By("creating a CustomRuntimeEnvironment object")
+			cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-4", Namespace: "default"},
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+						BuildType:  meteorv1alpha1.Containerfile,
+						Repository: "https://github.com/thoth-station/s2i-custom-notebook.git",
+						GitRef:     "HEAD",
+						Containerfile: &meteorv1alpha1.FileSource{
+							ConfigMapKeyRef: &meteorv1alpha1.ConfigMapKeyReference{Name: "test-4-files", Key: "Containerfile"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: "test-4", Namespace: "default"}
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.BuildFileUnavailable)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.PipelineRunCreated)).To(BeFalse())
+				g.Expect(createdCRE.Status.Phase).NotTo(Equal(meteorv1alpha1.PhaseFailed))
+			}, timeout, interval).Should(Succeed())
+
+			By("creating the ConfigMap")
+			configMap := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-4-files", Namespace: "default"},
+				Data:       map[string]string{"Containerfile": "FROM quay.io/thoth-station/s2i-custom-notebook:latest"},
+			}
+			Expect(k8sClient.Create(context.Background(), configMap)).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(meta.FindStatusCondition(createdCRE.Status.Conditions, meteorv1alpha1.BuildFileUnavailable)).To(BeNil())
+				g.Expect(meta.IsStatusConditionTrue(createdCRE.Status.Conditions, meteorv1alpha1.PipelineRunCreated)).To(BeTrue())
+			}, timeout, interval).Should(Succeed())
+		})
+	})
+
+	Context("when the force-rebuild annotation is set without changing the spec", func() {
+		It("should remove the annotation", func() {
+			By("creating a CustomRuntimeEnvironment object")
+			cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meteor.zone/v1alpha1", Kind: "CustomRuntimeEnvironment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-5", Namespace: "default"},
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+						BuildType: meteorv1alpha1.ImportImage,
+						FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), cre)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: "test-5", Namespace: "default"}
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(createdCRE.Status.ObservedGeneration).To(Equal(createdCRE.Generation))
+			}, timeout, interval).Should(Succeed())
+
+			By("setting the force-rebuild annotation")
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				metav1.SetMetaDataAnnotation(&createdCRE.ObjectMeta, meteorv1alpha1.CREForceRebuildAnnotationKey, "")
+				g.Expect(k8sClient.Update(ctx, createdCRE)).Should(Succeed())
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				createdCRE := &meteorv1alpha1.CustomRuntimeEnvironment{}
+				g.Expect(k8sClient.Get(ctx, lookupKey, createdCRE)).Should(Succeed())
+				g.Expect(createdCRE.Annotations).NotTo(HaveKey(meteorv1alpha1.CREForceRebuildAnnotationKey))
+			}, timeout, interval).Should(Succeed())
+		})
 	})
 })
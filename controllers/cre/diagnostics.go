@@ -0,0 +1,192 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	meta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// reconcileFailure records the failed step of a failed build in the status of the CustomRuntimeEnvironment
+// and maps well-known failures to their conditions.
+func (r *CustomRuntimeEnvironmentReconciler) reconcileFailure(cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildStatus) {
+	failure := &meteorv1alpha1.BuildFailure{}
+	if build.Failure != nil {
+		failure = build.Failure.DeepCopy()
+	}
+	failure.PipelineRunName = build.Name
+	cre.Status.Failure = failure
+
+	if condition := failureCondition(failure); condition != nil {
+		condition.ObservedGeneration = cre.Generation
+		meta.SetStatusCondition(&cre.Status.Conditions, *condition)
+	}
+}
+
+// failureFromTaskRuns returns the failure of the TaskRun that failed first, nil if none of them failed
+func failureFromTaskRuns(taskRuns []pipelinev1beta1.TaskRun) *meteorv1alpha1.BuildFailure {
+	failed := []pipelinev1beta1.TaskRun{}
+	for _, taskRun := range taskRuns {
+		if taskRun.IsDone() && !taskRun.IsSuccessful() {
+			failed = append(failed, taskRun)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	// tasks in the finally block may fail as a consequence, the root cause is the one that failed first
+	sort.SliceStable(failed, func(i, j int) bool {
+		if failed[j].Status.CompletionTime == nil {
+			return failed[i].Status.CompletionTime != nil
+		}
+		return failed[i].Status.CompletionTime.Before(failed[j].Status.CompletionTime)
+	})
+
+	return failureFromTaskRun(&failed[0])
+}
+
+// failureFromTaskRun returns the failure of the first step of the TaskRun that terminated unsuccessfully
+func failureFromTaskRun(taskRun *pipelinev1beta1.TaskRun) *meteorv1alpha1.BuildFailure {
+	failure := &meteorv1alpha1.BuildFailure{
+		TaskName:    taskRun.Labels[pipeline.PipelineTaskLabelKey],
+		TaskRunName: taskRun.Name,
+	}
+	if len(taskRun.Status.Conditions) > 0 {
+		failure.Reason = taskRun.Status.Conditions[0].Reason
+		failure.Message = taskRun.Status.Conditions[0].Message
+	}
+
+	for _, step := range taskRun.Status.Steps {
+		if step.Terminated == nil || step.Terminated.ExitCode == 0 {
+			continue
+		}
+
+		failure.StepName = step.Name
+		failure.ExitCode = step.Terminated.ExitCode
+		if step.Terminated.Message != "" {
+			failure.Message = step.Terminated.Message
+		}
+		break
+	}
+
+	return failure
+}
+
+// failureCondition maps well-known failures to the condition describing them, nil if the failure is unknown
+func failureCondition(failure *meteorv1alpha1.BuildFailure) *metav1.Condition {
+	message := fmt.Sprintf("Task %s failed", failure.TaskName)
+	if failure.StepName != "" {
+		message = fmt.Sprintf("%s in step %s with exit code %d", message, failure.StepName, failure.ExitCode)
+	}
+	if failure.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, failure.Message)
+	}
+
+	if isSecretMissing(failure) {
+		return &metav1.Condition{
+			Type:    meteorv1alpha1.RequiredSecretMissing,
+			Status:  metav1.ConditionTrue,
+			Reason:  "RequiredSecretMissing",
+			Message: message,
+		}
+	}
+
+	switch failure.TaskName {
+	case "resolve-dependencies":
+		return &metav1.Condition{
+			Type:    meteorv1alpha1.ErrorResolvingDependencies,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ErrorResolvingDependencies",
+			Message: message,
+		}
+	case "setup", "validate":
+		return &metav1.Condition{
+			Type:    meteorv1alpha1.ValidatingImportedImage,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ImportedImageInvalid",
+			Message: message,
+		}
+	case "build-image", "buildah":
+		reason := "ErrorBuildingImage"
+		if isRegistryUnavailable(failure) {
+			reason = "RegistryUnavailable"
+		}
+		return &metav1.Condition{
+			Type:    meteorv1alpha1.ErrorBuildingImage,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		}
+	}
+
+	return nil
+}
+
+// isSecretMissing returns true if the failure was caused by a missing secret or missing credentials
+func isSecretMissing(failure *meteorv1alpha1.BuildFailure) bool {
+	message := strings.ToLower(failure.Message)
+
+	if failure.Reason == "CreateContainerConfigError" {
+		return strings.Contains(message, "secret")
+	}
+
+	return strings.Contains(message, "unauthorized") || strings.Contains(message, "authentication required")
+}
+
+// registryUnavailableMessages are the messages of the failures to reach a registry or another server of the build,
+// e.g. buildah pulling the base image or pushing the image, which are likely to succeed when tried again
+var registryUnavailableMessages = []string{
+	"i/o timeout",
+	"tls handshake timeout",
+	"context deadline exceeded",
+	"connection refused",
+	"connection reset by peer",
+	"no such host",
+	"temporary failure in name resolution",
+	"network is unreachable",
+	"unexpected eof",
+	"too many requests",
+	"toomanyrequests",
+}
+
+// serverErrorPattern matches the 5xx responses of registries, e.g. "received unexpected HTTP status: 502 Bad Gateway"
+var serverErrorPattern = regexp.MustCompile(`(?i)(http status|status code):? 5[0-9][0-9]\b|\b50[0234] (internal server error|bad gateway|service unavailable|gateway timeout)\b`)
+
+// isRegistryUnavailable returns true if the failure was caused by a registry or network error, e.g. a timeout or a
+// 5xx response while pulling or pushing an image, rather than by the build itself
+func isRegistryUnavailable(failure *meteorv1alpha1.BuildFailure) bool {
+	message := strings.ToLower(failure.Reason + " " + failure.Message)
+	for _, registryUnavailable := range registryUnavailableMessages {
+		if strings.Contains(message, registryUnavailable) {
+			return true
+		}
+	}
+
+	return serverErrorPattern.MatchString(message)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+func failedTaskRun(name, task string, completed time.Time, steps ...pipelinev1beta1.StepState) pipelinev1beta1.TaskRun {
+	completionTime := metav1.NewTime(completed)
+
+	return pipelinev1beta1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{pipeline.PipelineTaskLabelKey: task},
+		},
+		Status: pipelinev1beta1.TaskRunStatus{
+			Status: duckv1beta1.Status{
+				Conditions: duckv1beta1.Conditions{{
+					Type:    apis.ConditionSucceeded,
+					Status:  v1.ConditionFalse,
+					Reason:  "Failed",
+					Message: "\"step-" + task + "\" exited with code 1",
+				}},
+			},
+			TaskRunStatusFields: pipelinev1beta1.TaskRunStatusFields{
+				CompletionTime: &completionTime,
+				Steps:          steps,
+			},
+		},
+	}
+}
+
+func terminatedStep(name string, exitCode int32, message string) pipelinev1beta1.StepState {
+	return pipelinev1beta1.StepState{
+		Name: name,
+		ContainerState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode, Message: message},
+		},
+	}
+}
+
+// TestFailureFromTaskRuns tests if the root cause of a failed PipelineRun is found
+func TestFailureFromTaskRuns(t *testing.T) {
+	now := time.Now()
+
+	testCases := map[string]struct {
+		taskRuns       []pipelinev1beta1.TaskRun
+		expectedOutput *meteorv1alpha1.BuildFailure
+	}{
+		"no-failure": {
+			taskRuns:       []pipelinev1beta1.TaskRun{},
+			expectedOutput: nil,
+		},
+		"resolve-dependencies": {
+			taskRuns: []pipelinev1beta1.TaskRun{
+				failedTaskRun("cre-test-1-package-list-update", "update-imagestream", now),
+				failedTaskRun("cre-test-1-package-list-resolve", "resolve-dependencies", now.Add(-time.Minute),
+					terminatedStep("format-unpinned-packages-to-file", 0, ""),
+					terminatedStep("resolve-packages", 2, "Could not find a version that matches pandas>>1.0"),
+				),
+			},
+			expectedOutput: &meteorv1alpha1.BuildFailure{
+				TaskName:    "resolve-dependencies",
+				TaskRunName: "cre-test-1-package-list-resolve",
+				StepName:    "resolve-packages",
+				ExitCode:    2,
+				Reason:      "Failed",
+				Message:     "Could not find a version that matches pandas>>1.0",
+			},
+		},
+		"no-termination-message": {
+			taskRuns: []pipelinev1beta1.TaskRun{
+				failedTaskRun("cre-test-1-import-setup", "setup", now,
+					terminatedStep("setup", 1, ""),
+				),
+			},
+			expectedOutput: &meteorv1alpha1.BuildFailure{
+				TaskName:    "setup",
+				TaskRunName: "cre-test-1-import-setup",
+				StepName:    "setup",
+				ExitCode:    1,
+				Reason:      "Failed",
+				Message:     "\"step-setup\" exited with code 1",
+			},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		output := failureFromTaskRuns(tc.taskRuns)
+		if tc.expectedOutput == nil {
+			if output != nil {
+				t.Errorf("%s Got %v while expecting no failure", tcName, output)
+			}
+			continue
+		}
+		if output == nil || *output != *tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestFailureCondition tests if well-known failures are mapped to their conditions
+func TestFailureCondition(t *testing.T) {
+	testCases := map[string]struct {
+		failure        meteorv1alpha1.BuildFailure
+		expectedType   string
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		"resolve-dependencies": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "resolve-dependencies", StepName: "resolve-packages", ExitCode: 2},
+			expectedType:   meteorv1alpha1.ErrorResolvingDependencies,
+			expectedStatus: metav1.ConditionTrue,
+		},
+		"validate": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "validate", StepName: "validate", ExitCode: 1},
+			expectedType:   meteorv1alpha1.ValidatingImportedImage,
+			expectedStatus: metav1.ConditionFalse,
+		},
+		"build-image": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "run", ExitCode: 1},
+			expectedType:   meteorv1alpha1.ErrorBuildingImage,
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "ErrorBuildingImage",
+		},
+		"push-timeout": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "push", ExitCode: 125, Message: "Error: writing blob: Patch \"https://quay.io/v2/thoth-station/cre/blobs/uploads/\": dial tcp 54.144.203.57:443: i/o timeout"},
+			expectedType:   meteorv1alpha1.ErrorBuildingImage,
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "RegistryUnavailable",
+		},
+		"pull-bad-gateway": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "buildah", StepName: "from", ExitCode: 125, Message: "Error: reading manifest latest in quay.io/thoth-station/s2i-custom-py38-notebook: received unexpected HTTP status: 502 Bad Gateway"},
+			expectedType:   meteorv1alpha1.ErrorBuildingImage,
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "RegistryUnavailable",
+		},
+		"unauthorized": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "from", ExitCode: 125, Message: "Error: reading manifest: unauthorized: access to the requested resource is not authorized"},
+			expectedType:   meteorv1alpha1.RequiredSecretMissing,
+			expectedStatus: metav1.ConditionTrue,
+		},
+		"secret-not-found": {
+			failure:        meteorv1alpha1.BuildFailure{TaskName: "setup", Reason: "CreateContainerConfigError", Message: "secret \"quay-pull-secret\" not found"},
+			expectedType:   meteorv1alpha1.RequiredSecretMissing,
+			expectedStatus: metav1.ConditionTrue,
+		},
+		"unknown": {
+			failure:      meteorv1alpha1.BuildFailure{TaskName: "create-image-stream", StepName: "oc", ExitCode: 1},
+			expectedType: "",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		output := failureCondition(&tc.failure)
+		if tc.expectedType == "" {
+			if output != nil {
+				t.Errorf("%s Got %v while expecting no condition", tcName, output)
+			}
+			continue
+		}
+		if output == nil || output.Type != tc.expectedType || output.Status != tc.expectedStatus {
+			t.Errorf("%s Got %v while expecting %s=%s", tcName, output, tc.expectedType, tc.expectedStatus)
+			continue
+		}
+		if tc.expectedReason != "" && output.Reason != tc.expectedReason {
+			t.Errorf("%s Got reason %s while expecting %s", tcName, output.Reason, tc.expectedReason)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// fileContent returns the content of a file used for building, read from the referenced ConfigMap if not given inline.
+// A file which is not given has no content.
+func (r *CustomRuntimeEnvironmentReconciler) fileContent(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, source *meteorv1alpha1.FileSource) (string, error) {
+	if source == nil {
+		return "", nil
+	}
+	if source.ConfigMapKeyRef == nil {
+		return source.Content, nil
+	}
+
+	configMap := &v1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: source.ConfigMapKeyRef.Name, Namespace: cre.Namespace}, configMap); err != nil {
+		return "", fmt.Errorf("unable to read ConfigMap %s: %w", source.ConfigMapKeyRef.Name, err)
+	}
+
+	content, ok := configMap.Data[source.ConfigMapKeyRef.Key]
+	if !ok {
+		return "", fmt.Errorf("ConfigMap %s has no key %s", source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)
+	}
+
+	return content, nil
+}
+
+// setBuildFileUnavailable records that the build can not be submitted yet, as a file used for building is not
+// available. The build is submitted once the ConfigMap providing it changes.
+func (r *CustomRuntimeEnvironmentReconciler) setBuildFileUnavailable(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, err error) {
+	log.FromContext(ctx).Error(err, "Unable to read file used for building")
+
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.BuildFileUnavailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ConfigMapUnavailable",
+		Message:            err.Error(),
+	})
+}
+
+// usesConfigMap returns true if one of the files used for building the CustomRuntimeEnvironment is read from the
+// named ConfigMap
+func usesConfigMap(cre *meteorv1alpha1.CustomRuntimeEnvironment, name string) bool {
+	for _, source := range []*meteorv1alpha1.FileSource{cre.Spec.Containerfile, cre.Spec.EnvironmentFile, cre.Spec.Pipfile, cre.Spec.PipfileLock} {
+		if source != nil && source.ConfigMapKeyRef != nil && source.ConfigMapKeyRef.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildFileMissingCustomRuntimeEnvironments maps a changed ConfigMap to the CustomRuntimeEnvironments of its namespace
+// which are waiting for a file it provides to build, so they are retried
+func (r *CustomRuntimeEnvironmentReconciler) buildFileMissingCustomRuntimeEnvironments(configMap client.Object) []reconcile.Request {
+	logger := log.Log.WithValues("configMap", types.NamespacedName{Name: configMap.GetName(), Namespace: configMap.GetNamespace()})
+
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(context.Background(), cres, client.InNamespace(configMap.GetNamespace())); err != nil {
+		logger.Error(err, "Unable to list CustomRuntimeEnvironments")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range cres.Items {
+		cre := &cres.Items[i]
+		if usesConfigMap(cre, configMap.GetName()) && meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.BuildFileUnavailable) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name}})
+		}
+	}
+
+	return requests
+}
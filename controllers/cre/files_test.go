@@ -0,0 +1,69 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestUsesConfigMap tests if the ConfigMaps the files used for building are read from are found
+func TestUsesConfigMap(t *testing.T) {
+	fromConfigMap := func(name string) *meteorv1alpha1.FileSource {
+		return &meteorv1alpha1.FileSource{ConfigMapKeyRef: &meteorv1alpha1.ConfigMapKeyReference{Name: name, Key: "file"}}
+	}
+
+	testCases := map[string]struct {
+		spec           meteorv1alpha1.BuildTypeSpec
+		expectedOutput bool
+	}{
+		"pipfile": {
+			spec:           meteorv1alpha1.BuildTypeSpec{Pipfile: fromConfigMap("other"), PipfileLock: fromConfigMap("files")},
+			expectedOutput: true,
+		},
+		"environment-file": {
+			spec:           meteorv1alpha1.BuildTypeSpec{EnvironmentFile: fromConfigMap("files")},
+			expectedOutput: true,
+		},
+		"containerfile": {
+			spec:           meteorv1alpha1.BuildTypeSpec{Containerfile: fromConfigMap("files")},
+			expectedOutput: true,
+		},
+		"other-configmap": {
+			spec:           meteorv1alpha1.BuildTypeSpec{Containerfile: fromConfigMap("other")},
+			expectedOutput: false,
+		},
+		"inline-content": {
+			spec:           meteorv1alpha1.BuildTypeSpec{Containerfile: &meteorv1alpha1.FileSource{Content: "FROM scratch"}},
+			expectedOutput: false,
+		},
+		"no-files": {
+			expectedOutput: false,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTypeSpec: tc.spec},
+		}
+
+		if output := usesConfigMap(cre, "files"); output != tc.expectedOutput {
+			t.Errorf("%s Got %t while expecting %t", tcName, output, tc.expectedOutput)
+		}
+	}
+}
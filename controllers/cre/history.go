@@ -0,0 +1,103 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// pruneBuilds deletes the builds of the CustomRuntimeEnvironment which are neither the latest run of the current
+// generation nor the run of a generation kept in the build history, together with the ImageStreams they pushed to
+// unless their image is still referenced.
+func (r *CustomRuntimeEnvironmentReconciler) pruneBuilds(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) error {
+	retain := func(name string, generation int64) bool {
+		return isRetainedBuild(cre, name, generation)
+	}
+
+	// the builds of previous generations may have been run by another backend
+	pruned := []string{}
+	for _, backend := range r.Backends {
+		names, err := backend.Cleanup(ctx, cre, retain)
+		if err != nil {
+			return err
+		}
+		pruned = append(pruned, names...)
+	}
+
+	referenced := map[string]bool{}
+	for _, name := range imageStreamNames(cre, nil) {
+		referenced[name] = true
+	}
+	imageStreams := []string{}
+	for _, name := range pruned {
+		if !referenced[name] {
+			imageStreams = append(imageStreams, name)
+		}
+	}
+
+	return r.deleteImageStreams(ctx, cre, imageStreams)
+}
+
+// cancelBuilds cancels the builds of previous generations which are still running, their
+// results would no longer match the spec of the CustomRuntimeEnvironment.
+func (r *CustomRuntimeEnvironmentReconciler) cancelBuilds(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) error {
+	retain := func(_ string, generation int64) bool {
+		return generation >= cre.Generation
+	}
+
+	for _, backend := range r.Backends {
+		if err := backend.Cancel(ctx, cre, retain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRetainedBuild returns true if the named build of the given generation has to be kept. Of the runs of the current
+// generation, retried or rebuilt, only the latest one is kept, and of the generations kept in the build history only
+// the run recorded there.
+func isRetainedBuild(cre *meteorv1alpha1.CustomRuntimeEnvironment, name string, generation int64) bool {
+	if generation > cre.Generation {
+		return true
+	}
+
+	if generation == cre.Generation {
+		// no run of the current generation is known yet
+		if len(cre.Status.Pipelines) == 0 {
+			return true
+		}
+		for _, pipeline := range cre.Status.Pipelines {
+			if pipeline.PipelineRunName == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, entry := range cre.Status.BuildHistory {
+		if entry.Generation == generation && entry.PipelineRunName == name {
+			return true
+		}
+	}
+
+	return false
+}
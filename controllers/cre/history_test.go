@@ -0,0 +1,108 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestIsRetainedBuild tests if only the latest run of the current generation and the runs recorded in the build
+// history are kept, so that the previous rebuilds and retries are pruned
+func TestIsRetainedBuild(t *testing.T) {
+	rebuilt := &meteorv1alpha1.CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 3},
+		Status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{
+			Rebuilds: 3,
+			Retries:  1,
+			Pipelines: []meteorv1alpha1.PipelineResult{
+				{Name: "test", PipelineRunName: "cre-test-3-rebuild-3-retry-1-package-list"},
+			},
+			BuildHistory: []meteorv1alpha1.BuildHistoryEntry{
+				{Generation: 2, PipelineRunName: "cre-test-2-rebuild-1-package-list"},
+			},
+		},
+	}
+	unsubmitted := &meteorv1alpha1.CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 3},
+	}
+
+	testCases := map[string]struct {
+		cre            *meteorv1alpha1.CustomRuntimeEnvironment
+		name           string
+		generation     int64
+		expectedOutput bool
+	}{
+		"latest-run": {
+			cre:            rebuilt,
+			name:           "cre-test-3-rebuild-3-retry-1-package-list",
+			generation:     3,
+			expectedOutput: true,
+		},
+		"failed-run-of-latest-rebuild": {
+			cre:            rebuilt,
+			name:           "cre-test-3-rebuild-3-package-list",
+			generation:     3,
+			expectedOutput: false,
+		},
+		"previous-rebuild": {
+			cre:            rebuilt,
+			name:           "cre-test-3-rebuild-2-package-list",
+			generation:     3,
+			expectedOutput: false,
+		},
+		"first-build": {
+			cre:            rebuilt,
+			name:           "cre-test-3-package-list",
+			generation:     3,
+			expectedOutput: false,
+		},
+		"run-in-history": {
+			cre:            rebuilt,
+			name:           "cre-test-2-rebuild-1-package-list",
+			generation:     2,
+			expectedOutput: true,
+		},
+		"other-run-of-generation-in-history": {
+			cre:            rebuilt,
+			name:           "cre-test-2-package-list",
+			generation:     2,
+			expectedOutput: false,
+		},
+		"generation-not-in-history": {
+			cre:            rebuilt,
+			name:           "cre-test-1-package-list",
+			generation:     1,
+			expectedOutput: false,
+		},
+		"current-generation-not-submitted-yet": {
+			cre:            unsubmitted,
+			name:           "cre-test-3-package-list",
+			generation:     3,
+			expectedOutput: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := isRetainedBuild(tc.cre, tc.name, tc.generation); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
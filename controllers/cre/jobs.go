@@ -0,0 +1,476 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// jobBackend runs the builds as Kubernetes Jobs running buildah, for clusters without Tekton.
+// The image is pushed to <Registry>/<namespace>/<build>:latest, and the results are reported
+// in the termination message of the build container.
+type jobBackend struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader reads the objects not cached, such as the Pods of the build Jobs
+	APIReader client.Reader
+	// BuilderImage is the buildah image running the builds
+	BuilderImage string
+	// Registry is the registry the built images are pushed to, the builds fail to submit without one
+	Registry string
+}
+
+// names of the containers of a build Job, they take the role of the tasks of our pipelines
+const (
+	gitCloneContainerName   = "git-clone"
+	buildImageContainerName = "build-image"
+	validateContainerName   = "validate"
+)
+
+// building blocks of the job scripts, starting from the base image and pushing the image of the build. buildah
+// trusts the CA bundle of the build mounted at /ca-bundle, and the commands run in the image trust it in addition
+// to the CAs of the builder image.
+const (
+	caBundleScript = `{ cat /etc/pki/tls/certs/ca-bundle.crt /ca-bundle/ca.crt 2>/dev/null || true; } > /workspace/ca-bundle.crt
+run_in_image() {
+  buildah run --volume /workspace/ca-bundle.crt:/tmp/ca-bundle.crt:ro cre-image -- \
+    env PIP_CERT=/tmp/ca-bundle.crt REQUESTS_CA_BUNDLE=/tmp/ca-bundle.crt SSL_CERT_FILE=/tmp/ca-bundle.crt "$@"
+}
+`
+	buildahFromScript = `buildah from --cert-dir /ca-bundle --name cre-image "docker://$PARAM_BASEIMAGE"
+`
+	buildahPushScript = `buildah push --cert-dir /ca-bundle --digestfile /workspace/digest "$IMAGE" "docker://$IMAGE"
+printf '{"IMAGE_URL":"%s","IMAGE_DIGEST":"%s","BASE_IMAGE":"%s"}' "$IMAGE" "$(cat /workspace/digest)" "${PARAM_BASEIMAGE:-}" > /dev/termination-log
+`
+	buildahCommitScript = `buildah commit cre-image "$IMAGE"
+` + buildahPushScript
+)
+
+// jobScripts are the shell scripts building the image of each pipeline, the parameters are passed as PARAM_<NAME>
+var jobScripts = map[string]string{
+	"import": `buildah pull --cert-dir /ca-bundle "docker://$PARAM_BASEIMAGE"
+buildah tag "$PARAM_BASEIMAGE" "$IMAGE"
+` + buildahPushScript,
+	"package-list": `if [ -n "${PARAM_LOCKEDREQUIREMENTS:-}" ]; then
+  printf '%s\n' "$PARAM_LOCKEDREQUIREMENTS" > /workspace/requirements.txt
+else
+  printf '%s\n' "${PARAM_PACKAGES:-}" > /workspace/requirements.txt
+fi
+` + buildahFromScript + `buildah copy cre-image /workspace/requirements.txt /tmp/requirements.txt
+run_in_image pip install --no-cache-dir -r /tmp/requirements.txt
+` + buildahCommitScript,
+	"conda-environment": `printf '%s\n' "$PARAM_ENVIRONMENTFILE" > /workspace/environment.yml
+` + buildahFromScript + `buildah copy cre-image /workspace/environment.yml /tmp/
+run_in_image conda env update --name base --file /tmp/environment.yml
+` + buildahCommitScript,
+	"pipenv": `mkdir -p /workspace/pipenv
+printf '%s\n' "$PARAM_PIPFILE" > /workspace/pipenv/Pipfile
+if [ -n "${PARAM_PIPFILELOCK:-}" ]; then
+  printf '%s\n' "$PARAM_PIPFILELOCK" > /workspace/pipenv/Pipfile.lock
+fi
+` + buildahFromScript + `buildah copy cre-image /workspace/pipenv/ /tmp/pipenv/
+run_in_image pip install pipenv
+run_in_image sh -c 'cd /tmp/pipenv && if [ -f Pipfile.lock ]; then pipenv install --system --deploy; else pipenv install --system; fi'
+` + buildahCommitScript,
+	"containerfile": `context="/workspace/source/${PARAM_CONTEXTDIR:-}"
+mkdir -p "$context"
+if [ -n "${PARAM_CONTAINERFILE:-}" ]; then
+  printf '%s\n' "$PARAM_CONTAINERFILE" > /workspace/Containerfile
+  containerfile=/workspace/Containerfile
+else
+  containerfile="$context/$PARAM_CONTAINERFILEPATH"
+fi
+buildah bud --cert-dir /ca-bundle --file "$containerfile" --tag "$IMAGE" "$context"
+` + buildahPushScript,
+}
+
+// gitCloneScript checks out the repository of a Containerfile build into the workspace, with the credentials of
+// the git secret mounted at /git-credentials if the repository is private
+const gitCloneScript = `if [ -f /git-credentials/ssh-privatekey ]; then
+  install -m 600 /git-credentials/ssh-privatekey /tmp/git-ssh-key
+  GIT_SSH_COMMAND="ssh -i /tmp/git-ssh-key -o StrictHostKeyChecking=accept-new"
+  if [ -f /git-credentials/known_hosts ]; then
+    GIT_SSH_COMMAND="ssh -i /tmp/git-ssh-key -o UserKnownHostsFile=/git-credentials/known_hosts"
+  fi
+  export GIT_SSH_COMMAND
+fi
+if [ -f /git-credentials/username ]; then
+  git config --global credential.helper '!f() { echo "username=$(cat /git-credentials/username)"; echo "password=$(cat /git-credentials/password)"; }; f'
+fi
+git clone "$PARAM_URL" /workspace/source
+cd /workspace/source
+git checkout "$PARAM_REF"
+`
+
+// SetupWithManager indexes the Jobs by their owner and watches them
+func (b *jobBackend) SetupWithManager(mgr ctrl.Manager, bldr *builder.Builder) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &batchv1.Job{}, buildOwnerKey, indexBuildOwner); err != nil {
+		return err
+	}
+	bldr.Owns(&batchv1.Job{})
+
+	return nil
+}
+
+// Submit creates the Job of the build
+func (b *jobBackend) Submit(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildRequest) error {
+	job, err := b.job(cre, build)
+	if err != nil {
+		return err
+	}
+	if err := controllerutil.SetControllerReference(cre, job, b.Scheme); err != nil {
+		return err
+	}
+
+	return b.Create(ctx, job)
+}
+
+// job returns the Job running the build
+func (b *jobBackend) job(cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildRequest) (*batchv1.Job, error) {
+	script, ok := jobScripts[build.Pipeline]
+	if !ok {
+		return nil, fmt.Errorf("%s builds are not supported by the %s build backend", cre.Spec.BuildType, meteorv1alpha1.JobBuildBackend)
+	}
+	// the Job does not record the pinned requirements of the build, which a Locked rebuild would reuse
+	if cre.Spec.LockMode == meteorv1alpha1.Locked {
+		return nil, fmt.Errorf("%s builds are not supported by the %s build backend", meteorv1alpha1.Locked, meteorv1alpha1.JobBuildBackend)
+	}
+
+	builderImage := b.BuilderImage
+	if builderImage == "" {
+		builderImage = defaultJobBuilderImage
+	}
+	if b.Registry == "" {
+		return nil, fmt.Errorf("no registry to push the images of the %s build backend to, set jobBuildBackend.registry in the operator config", meteorv1alpha1.JobBuildBackend)
+	}
+
+	env := []v1.EnvVar{
+		{Name: "IMAGE", Value: fmt.Sprintf("%s/%s/%s:latest", b.Registry, cre.Namespace, build.Name)},
+		{Name: "STORAGE_DRIVER", Value: "vfs"},
+		{Name: "BUILDAH_FORMAT", Value: "oci"},
+		{Name: "BUILDAH_ISOLATION", Value: "chroot"},
+	}
+	for _, param := range build.Params {
+		value := param.Value
+		if param.Values != nil {
+			value = strings.Join(param.Values, "\n")
+		}
+		env = append(env, v1.EnvVar{Name: "PARAM_" + strings.ToUpper(param.Name), Value: value})
+	}
+
+	workspace := v1.VolumeMount{Name: "workspace", MountPath: "/workspace"}
+	workspaceVolume := v1.VolumeSource{
+		Ephemeral: &v1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &v1.PersistentVolumeClaimTemplate{Spec: *build.Workspace.VolumeClaimTemplate.DeepCopy()},
+		},
+	}
+	if build.Workspace.ClaimName != "" {
+		workspace.SubPath = build.Name
+		workspaceVolume = v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: build.Workspace.ClaimName},
+		}
+	}
+
+	containerName := buildImageContainerName
+	if build.Pipeline == "import" {
+		containerName = validateContainerName
+	}
+
+	labels := map[string]string{
+		pipelineLabelKey:   build.Pipeline,
+		generationLabelKey: strconv.FormatInt(cre.GetGeneration(), 10),
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      build.Name,
+			Namespace: cre.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          pointer.Int32(0),
+			ActiveDeadlineSeconds: activeDeadlineSeconds(build.Timeout),
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					RestartPolicy: v1.RestartPolicyNever,
+					Containers: []v1.Container{{
+						Name:    containerName,
+						Image:   builderImage,
+						Command: []string{"/bin/sh", "-c", "set -eu\n" + caBundleScript + script},
+						Env:     env,
+						SecurityContext: &v1.SecurityContext{
+							Capabilities: &v1.Capabilities{Add: []v1.Capability{"SETFCAP"}},
+						},
+						VolumeMounts: []v1.VolumeMount{
+							workspace,
+							{Name: "containers", MountPath: "/var/lib/containers"},
+							{Name: "ca-bundle", MountPath: "/ca-bundle", ReadOnly: true},
+						},
+					}},
+					Volumes: []v1.Volume{
+						{Name: "workspace", VolumeSource: workspaceVolume},
+						{Name: "containers", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+						{Name: "ca-bundle", VolumeSource: v1.VolumeSource{ConfigMap: caBundleVolumeSource(build.CABundle)}},
+					},
+				},
+			},
+		},
+	}
+
+	// Containerfile builds from a repository check it out first
+	if build.Pipeline == "containerfile" && build.param("url") != "" {
+		gitClone := v1.Container{
+			Name:    gitCloneContainerName,
+			Image:   jobGitImage,
+			Command: []string{"/bin/sh", "-c", "set -eu\n" + gitCloneScript},
+			// the git configuration holding the credential helper must be writable whatever the user
+			Env:          append(append([]v1.EnvVar{}, env...), v1.EnvVar{Name: "HOME", Value: "/tmp"}),
+			VolumeMounts: []v1.VolumeMount{workspace},
+		}
+		if build.GitSecret != "" {
+			gitClone.VolumeMounts = append(gitClone.VolumeMounts, v1.VolumeMount{Name: "git-credentials", MountPath: "/git-credentials", ReadOnly: true})
+			job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, v1.Volume{
+				Name:         "git-credentials",
+				VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: build.GitSecret}},
+			})
+		}
+		job.Spec.Template.Spec.InitContainers = []v1.Container{gitClone}
+	}
+
+	// buildah and skopeo pull the base image, or the image to import, with the credentials of the secret
+	if build.ImagePullSecret != "" {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "REGISTRY_AUTH_FILE", Value: "/registry-credentials/config.json"})
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{Name: "registry-credentials", MountPath: "/registry-credentials", ReadOnly: true})
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, v1.Volume{
+			Name:         "registry-credentials",
+			VolumeSource: v1.VolumeSource{Secret: registryCredentialsVolumeSource(build.ImagePullSecret)},
+		})
+	}
+
+	return job, nil
+}
+
+// Status returns the status of the Job of the build
+func (b *jobBackend) Status(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, name string) (*BuildStatus, error) {
+	job := &batchv1.Job{}
+	if err := b.Get(ctx, types.NamespacedName{Name: name, Namespace: cre.Namespace}, job); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	status := &BuildStatus{Name: name, State: BuildRunning, StartTime: &job.CreationTimestamp}
+	condition := finishedJobCondition(job)
+	// Cancel suspends the Job, its Pods are gone then
+	if condition != nil && condition.Type == batchv1.JobSuspended {
+		status.State = BuildCancelled
+		status.CompletionTime = &condition.LastTransitionTime
+		return status, nil
+	}
+
+	pods := &v1.PodList{}
+	if err := b.APIReader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels(job.Spec.Selector.MatchLabels)); err != nil {
+		return nil, fmt.Errorf("unable to list Pods of Job: %w", err)
+	}
+	if condition == nil {
+		status.Pending = !podsStarted(pods.Items)
+		return status, nil
+	}
+
+	status.CompletionTime = job.Status.CompletionTime
+	if status.CompletionTime == nil {
+		status.CompletionTime = &condition.LastTransitionTime
+	}
+	if condition.Type == batchv1.JobComplete {
+		status.State = BuildSucceeded
+		status.Results = resultsFromPods(pods.Items)
+		return status, nil
+	}
+
+	status.State = BuildFailed
+	status.TimedOut = condition.Reason == "DeadlineExceeded"
+	status.Failure = failureFromPods(pods.Items)
+	if status.Failure == nil {
+		// the Job failed before any of its containers did, e.g. the Pod could not be created
+		status.Failure = &meteorv1alpha1.BuildFailure{Reason: condition.Reason, Message: condition.Message}
+	}
+
+	return status, nil
+}
+
+// finishedJobCondition returns the condition of a finished Job, nil while it runs
+func finishedJobCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete, batchv1.JobFailed, batchv1.JobSuspended:
+			return condition
+		}
+	}
+
+	return nil
+}
+
+// activeDeadlineSeconds returns the deadline of the Job of a build of the given timeout, nil for no timeout
+func activeDeadlineSeconds(timeout time.Duration) *int64 {
+	if timeout <= 0 {
+		return nil
+	}
+
+	return pointer.Int64(int64(timeout.Seconds()))
+}
+
+// podsStarted returns true once a container of one of the Pods has started
+func podsStarted(pods []v1.Pod) bool {
+	for _, pod := range pods {
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, container := range statuses {
+			if container.State.Running != nil || container.State.Terminated != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resultsFromPods returns the results the build container reported in its termination message
+func resultsFromPods(pods []v1.Pod) map[string]string {
+	for _, pod := range pods {
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Terminated == nil || container.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			results := map[string]string{}
+			if err := json.Unmarshal([]byte(container.State.Terminated.Message), &results); err == nil {
+				return results
+			}
+		}
+	}
+
+	return map[string]string{}
+}
+
+// failureFromPods returns the failure of the first container of the Pods that did not succeed, nil if none of them failed
+func failureFromPods(pods []v1.Pod) *meteorv1alpha1.BuildFailure {
+	for _, pod := range pods {
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, container := range statuses {
+			failure := &meteorv1alpha1.BuildFailure{
+				TaskName:    container.Name,
+				TaskRunName: pod.Name,
+				StepName:    container.Name,
+			}
+			switch {
+			case container.State.Terminated != nil && container.State.Terminated.ExitCode != 0:
+				failure.ExitCode = container.State.Terminated.ExitCode
+				failure.Reason = container.State.Terminated.Reason
+				failure.Message = container.State.Terminated.Message
+			case container.State.Waiting != nil && container.State.Waiting.Reason != "":
+				failure.Reason = container.State.Waiting.Reason
+				failure.Message = container.State.Waiting.Message
+			default:
+				continue
+			}
+			return failure
+		}
+	}
+
+	return nil
+}
+
+// Cancel suspends the Jobs not retained which are still running, which deletes their Pods
+func (b *jobBackend) Cancel(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) error {
+	logger := log.FromContext(ctx)
+
+	jobs := &batchv1.JobList{}
+	if err := b.List(ctx, jobs, client.InNamespace(cre.Namespace), client.MatchingFields{buildOwnerKey: cre.Name}); err != nil {
+		return err
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if finishedJobCondition(job) != nil || pointer.BoolDeref(job.Spec.Suspend, false) {
+			continue
+		}
+		if !isDiscarded(job, retain) {
+			continue
+		}
+
+		logger.Info("Cancelling Job", "job", job.Name)
+		patch := client.MergeFrom(job.DeepCopy())
+		job.Spec.Suspend = pointer.Bool(true)
+		if err := b.Patch(ctx, job, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cleanup deletes the Jobs not retained, together with their Pods, the workspaces are ephemeral volumes of the Pods
+func (b *jobBackend) Cleanup(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	jobs := &batchv1.JobList{}
+	if err := b.List(ctx, jobs, client.InNamespace(cre.Namespace), client.MatchingFields{buildOwnerKey: cre.Name}); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !isDiscarded(job, retain) {
+			continue
+		}
+
+		logger.Info("Deleting Job", "job", job.Name)
+		if err := b.Delete(ctx, job, client.PropagationPolicy("Background")); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		names = append(names, job.Name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,388 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+func containerStatus(name string, state v1.ContainerState) v1.ContainerStatus {
+	return v1.ContainerStatus{Name: name, State: state}
+}
+
+func terminated(exitCode int32, message string) v1.ContainerState {
+	return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode, Reason: "Error", Message: message}}
+}
+
+// TestJob tests if the Job of a build runs the script of its pipeline with the parameters in its environment, and
+// trusts the CA bundle of the build
+func TestJob(t *testing.T) {
+	backend := &jobBackend{Registry: defaultJobRegistry}
+	cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Generation: 2},
+	}
+
+	testCases := map[string]struct {
+		build             BuildRequest
+		expectedContainer string
+		expectedInit      bool
+		expectedEnv       map[string]string
+		noRegistry        bool
+		lockMode          meteorv1alpha1.LockMode
+		expectedError     bool
+	}{
+		"package-list": {
+			build: BuildRequest{
+				Name:     "cre-test-2-package-list",
+				Pipeline: "package-list",
+				Timeout:  time.Hour,
+				Params: []BuildParam{
+					{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"},
+					{Name: "packages", Values: []string{"numpy", "pandas"}},
+				},
+			},
+			expectedContainer: buildImageContainerName,
+			expectedEnv: map[string]string{
+				"IMAGE":             "image-registry.openshift-image-registry.svc:5000/default/cre-test-2-package-list:latest",
+				"PARAM_BASEIMAGE":   "quay.io/thoth-station/s2i-custom-py38-notebook:latest",
+				"PARAM_PACKAGES":    "numpy\npandas",
+				"STORAGE_DRIVER":    "vfs",
+				"BUILDAH_FORMAT":    "oci",
+				"BUILDAH_ISOLATION": "chroot",
+			},
+		},
+		"import": {
+			build: BuildRequest{
+				Name:     "cre-test-2-import",
+				Pipeline: "import",
+				Params:   []BuildParam{{Name: "baseImage", Value: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2"}},
+			},
+			expectedContainer: validateContainerName,
+		},
+		"private-import": {
+			build: BuildRequest{
+				Name:            "cre-test-2-import",
+				Pipeline:        "import",
+				Params:          []BuildParam{{Name: "baseImage", Value: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2"}},
+				ImagePullSecret: "thoth-station-pull-secret",
+			},
+			expectedContainer: validateContainerName,
+			expectedEnv: map[string]string{
+				"IMAGE":              "image-registry.openshift-image-registry.svc:5000/default/cre-test-2-import:latest",
+				"PARAM_BASEIMAGE":    "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+				"STORAGE_DRIVER":     "vfs",
+				"BUILDAH_FORMAT":     "oci",
+				"BUILDAH_ISOLATION":  "chroot",
+				"REGISTRY_AUTH_FILE": "/registry-credentials/config.json",
+			},
+		},
+		"containerfile-from-repository": {
+			build: BuildRequest{
+				Name:     "cre-test-2-containerfile",
+				Pipeline: "containerfile",
+				Params: []BuildParam{
+					{Name: "url", Value: "https://github.com/thoth-station/meteor-operator"},
+					{Name: "ref", Value: "HEAD"},
+				},
+			},
+			expectedContainer: buildImageContainerName,
+			expectedInit:      true,
+		},
+		"private-repository": {
+			build: BuildRequest{
+				Name:     "cre-test-2-containerfile",
+				Pipeline: "containerfile",
+				Params: []BuildParam{
+					{Name: "url", Value: "git@github.com:thoth-station/meteor-operator.git"},
+					{Name: "ref", Value: "HEAD"},
+				},
+				GitSecret: "meteor-operator-git",
+			},
+			expectedContainer: buildImageContainerName,
+			expectedInit:      true,
+		},
+		"inline-containerfile": {
+			build: BuildRequest{
+				Name:     "cre-test-2-containerfile",
+				Pipeline: "containerfile",
+				Params:   []BuildParam{{Name: "url"}, {Name: "containerfile", Value: "FROM scratch"}},
+			},
+			expectedContainer: buildImageContainerName,
+		},
+		"gitrepo-not-supported": {
+			build:         BuildRequest{Name: "cre-test-2-gitrepo", Pipeline: "gitrepo"},
+			expectedError: true,
+		},
+		"no-registry": {
+			build: BuildRequest{
+				Name:     "cre-test-2-package-list",
+				Pipeline: "package-list",
+				Params:   []BuildParam{{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"}},
+			},
+			noRegistry:    true,
+			expectedError: true,
+		},
+		"locked-not-supported": {
+			build: BuildRequest{
+				Name:     "cre-test-2-package-list",
+				Pipeline: "package-list",
+				Params:   []BuildParam{{Name: "baseImage", Value: "quay.io/thoth-station/s2i-custom-py38-notebook:latest"}},
+			},
+			lockMode:      meteorv1alpha1.Locked,
+			expectedError: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		b := backend
+		if tc.noRegistry {
+			b = &jobBackend{}
+		}
+		cre := cre.DeepCopy()
+		cre.Spec.LockMode = tc.lockMode
+		job, err := b.job(cre, &tc.build)
+		if tc.expectedError {
+			if err == nil {
+				t.Errorf("%s Got no error while expecting one", tcName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s Got error %v while expecting none", tcName, err)
+			continue
+		}
+
+		if job.Name != tc.build.Name || job.Labels[generationLabelKey] != "2" || job.Labels[pipelineLabelKey] != tc.build.Pipeline {
+			t.Errorf("%s Got Job %s with labels %v", tcName, job.Name, job.Labels)
+		}
+
+		container := job.Spec.Template.Spec.Containers[0]
+		if container.Name != tc.expectedContainer {
+			t.Errorf("%s Got container %s while expecting %s", tcName, container.Name, tc.expectedContainer)
+		}
+		if container.Image != defaultJobBuilderImage {
+			t.Errorf("%s Got builder image %s while expecting %s", tcName, container.Image, defaultJobBuilderImage)
+		}
+		if deadline := pointer.Int64Deref(job.Spec.ActiveDeadlineSeconds, 0); deadline != int64(tc.build.Timeout.Seconds()) {
+			t.Errorf("%s Got active deadline of %ds while expecting %s", tcName, deadline, tc.build.Timeout)
+		}
+		if init := len(job.Spec.Template.Spec.InitContainers) > 0; init != tc.expectedInit {
+			t.Errorf("%s Got init container %v while expecting %v", tcName, init, tc.expectedInit)
+		}
+
+		// buildah and the commands run in the image trust the CA bundle
+		mounted := false
+		for _, mount := range container.VolumeMounts {
+			mounted = mounted || (mount.Name == "ca-bundle" && mount.MountPath == "/ca-bundle")
+		}
+		if !mounted || !strings.Contains(container.Command[2], caBundleScript) {
+			t.Errorf("%s Got CA bundle mounted %v and script %q while expecting it trusted", tcName, mounted, container.Command[2])
+		}
+
+		// only the container cloning the repository gets the git secret
+		mounted = false
+		for _, init := range job.Spec.Template.Spec.InitContainers {
+			for _, mount := range init.VolumeMounts {
+				mounted = mounted || mount.Name == "git-credentials"
+			}
+		}
+		if mounted != (tc.build.GitSecret != "") {
+			t.Errorf("%s Got git secret mounted %v while expecting %v", tcName, mounted, tc.build.GitSecret != "")
+		}
+
+		// the build container pulls the images with the pull secret
+		mounted = false
+		for _, mount := range container.VolumeMounts {
+			mounted = mounted || mount.Name == "registry-credentials"
+		}
+		if mounted != (tc.build.ImagePullSecret != "") {
+			t.Errorf("%s Got image pull secret mounted %v while expecting %v", tcName, mounted, tc.build.ImagePullSecret != "")
+		}
+
+		if tc.expectedEnv != nil {
+			env := map[string]string{}
+			for _, variable := range container.Env {
+				env[variable.Name] = variable.Value
+			}
+			if !reflect.DeepEqual(env, tc.expectedEnv) {
+				t.Errorf("%s Got environment %v while expecting %v", tcName, env, tc.expectedEnv)
+			}
+		}
+	}
+}
+
+// TestResultsFromPods tests if the results are read from the termination message of the build container
+func TestResultsFromPods(t *testing.T) {
+	testCases := map[string]struct {
+		pods           []v1.Pod
+		expectedOutput map[string]string
+	}{
+		"no-pods": {
+			pods:           []v1.Pod{},
+			expectedOutput: map[string]string{},
+		},
+		"results": {
+			pods: []v1.Pod{{
+				Status: v1.PodStatus{
+					ContainerStatuses: []v1.ContainerStatus{
+						containerStatus(buildImageContainerName, terminated(0, `{"IMAGE_URL":"registry/default/cre-test-1-package-list:latest","IMAGE_DIGEST":"sha256:0123"}`)),
+					},
+				},
+			}},
+			expectedOutput: map[string]string{
+				imageURLResult:    "registry/default/cre-test-1-package-list:latest",
+				imageDigestResult: "sha256:0123",
+			},
+		},
+		"no-results": {
+			pods: []v1.Pod{{
+				Status: v1.PodStatus{
+					ContainerStatuses: []v1.ContainerStatus{containerStatus(buildImageContainerName, terminated(0, ""))},
+				},
+			}},
+			expectedOutput: map[string]string{},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := resultsFromPods(tc.pods); !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestFailureFromPods tests if the container that failed first is found in the Pods of a failed Job
+func TestFailureFromPods(t *testing.T) {
+	testCases := map[string]struct {
+		pods           []v1.Pod
+		expectedOutput *meteorv1alpha1.BuildFailure
+	}{
+		"no-pods": {
+			pods:           []v1.Pod{},
+			expectedOutput: nil,
+		},
+		"build-failed": {
+			pods: []v1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Name: "cre-test-1-package-list-abcde"},
+				Status: v1.PodStatus{
+					ContainerStatuses: []v1.ContainerStatus{containerStatus(buildImageContainerName, terminated(1, "pip failed"))},
+				},
+			}},
+			expectedOutput: &meteorv1alpha1.BuildFailure{
+				TaskName:    buildImageContainerName,
+				TaskRunName: "cre-test-1-package-list-abcde",
+				StepName:    buildImageContainerName,
+				ExitCode:    1,
+				Reason:      "Error",
+				Message:     "pip failed",
+			},
+		},
+		"clone-failed": {
+			pods: []v1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Name: "cre-test-1-containerfile-abcde"},
+				Status: v1.PodStatus{
+					InitContainerStatuses: []v1.ContainerStatus{containerStatus(gitCloneContainerName, terminated(128, "repository not found"))},
+					ContainerStatuses: []v1.ContainerStatus{containerStatus(buildImageContainerName, v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"},
+					})},
+				},
+			}},
+			expectedOutput: &meteorv1alpha1.BuildFailure{
+				TaskName:    gitCloneContainerName,
+				TaskRunName: "cre-test-1-containerfile-abcde",
+				StepName:    gitCloneContainerName,
+				ExitCode:    128,
+				Reason:      "Error",
+				Message:     "repository not found",
+			},
+		},
+		"secret-missing": {
+			pods: []v1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Name: "cre-test-1-import-abcde"},
+				Status: v1.PodStatus{
+					ContainerStatuses: []v1.ContainerStatus{containerStatus(validateContainerName, v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "CreateContainerConfigError", Message: "secret \"pull\" not found"},
+					})},
+				},
+			}},
+			expectedOutput: &meteorv1alpha1.BuildFailure{
+				TaskName:    validateContainerName,
+				TaskRunName: "cre-test-1-import-abcde",
+				StepName:    validateContainerName,
+				Reason:      "CreateContainerConfigError",
+				Message:     "secret \"pull\" not found",
+			},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := failureFromPods(tc.pods); !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestPodsStarted tests if a build is pending until one of the containers of its Pods has started
+func TestPodsStarted(t *testing.T) {
+	testCases := map[string]struct {
+		pods           []v1.Pod
+		expectedOutput bool
+	}{
+		"no-pods": {
+			pods:           []v1.Pod{},
+			expectedOutput: false,
+		},
+		"image-pull-backoff": {
+			pods: []v1.Pod{{
+				Status: v1.PodStatus{
+					ContainerStatuses: []v1.ContainerStatus{
+						containerStatus(buildImageContainerName, v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}),
+					},
+				},
+			}},
+			expectedOutput: false,
+		},
+		"cloning-repository": {
+			pods: []v1.Pod{{
+				Status: v1.PodStatus{
+					InitContainerStatuses: []v1.ContainerStatus{
+						containerStatus(gitCloneContainerName, v1.ContainerState{Running: &v1.ContainerStateRunning{}}),
+					},
+					ContainerStatuses: []v1.ContainerStatus{
+						containerStatus(buildImageContainerName, v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"}}),
+					},
+				},
+			}},
+			expectedOutput: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := podsStarted(tc.pods); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// lockConfigMapName returns the name of the ConfigMap holding the pinned requirements of the CustomRuntimeEnvironment
+func lockConfigMapName(cre *meteorv1alpha1.CustomRuntimeEnvironment) string {
+	return fmt.Sprintf("%s-lock", cre.Name)
+}
+
+// reconcileLock copies the pinned requirements resolved by a successful build into the ConfigMap
+// owned by the CustomRuntimeEnvironment, so they outlive the build and can be reused for rebuilds.
+func (r *CustomRuntimeEnvironmentReconciler) reconcileLock(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, build string) {
+	if cre.Status.Lock != nil && cre.Status.Lock.PipelineRunName == build {
+		return
+	}
+
+	// the pipeline stores the pinned requirements in a ConfigMap named after the PipelineRun
+	namespacedName := types.NamespacedName{Name: fmt.Sprintf("%s-lock", build), Namespace: cre.Namespace}
+	logger := log.FromContext(ctx).WithValues("configmap", namespacedName)
+
+	buildLock := &v1.ConfigMap{}
+	if err := r.Get(ctx, namespacedName, buildLock); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("Build did not record pinned requirements")
+			return
+		}
+		logger.Error(err, "Unable to fetch pinned requirements of build")
+		return
+	}
+
+	lock := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: lockConfigMapName(cre), Namespace: cre.Namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, lock, func() error {
+		lock.Data = map[string]string{
+			lockRequirementsKey: buildLock.Data[lockRequirementsKey],
+		}
+		return controllerutil.SetControllerReference(cre, lock, r.Scheme)
+	}); err != nil {
+		logger.Error(err, "Unable to store pinned requirements")
+		return
+	}
+
+	cre.Status.Lock = &meteorv1alpha1.LockStatus{
+		ConfigMapName:   lock.Name,
+		PipelineRunName: build,
+		PackageVersions: append([]string{}, cre.Spec.PackageVersions...),
+	}
+}
+
+// lockedRequirements returns the pinned requirements to reuse for the build, empty if the packages have to be resolved
+func (r *CustomRuntimeEnvironmentReconciler) lockedRequirements(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) (string, error) {
+	if cre.Spec.LockMode != meteorv1alpha1.Locked || !cre.HasMatchingLock() {
+		return "", nil
+	}
+
+	lock := &v1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cre.Status.Lock.ConfigMapName, Namespace: cre.Namespace}, lock); err != nil {
+		return "", err
+	}
+
+	return lock.Data[lockRequirementsKey], nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// clusterResolver is the Tekton resolver fetching Pipelines from other namespaces
+const clusterResolver = "cluster"
+
+// paramTemplateData is what the templates of the parameters are evaluated against
+type paramTemplateData struct {
+	*meteorv1alpha1.CustomRuntimeEnvironment
+	// Params are the parameters the operator passes by default, array parameters are joined by newlines
+	Params map[string]string
+}
+
+// validatePipelineConfigs checks that the pipeline references are unambiguous and the parameter templates parse
+func validatePipelineConfigs(configs map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig) error {
+	for buildType, config := range configs {
+		if ref := config.PipelineRef; ref != nil && ref.Bundle != "" && ref.Resolver != "" {
+			return fmt.Errorf("the Pipeline of %s builds is referenced by a bundle and a resolver", buildType)
+		}
+		for _, param := range config.Params {
+			if _, err := template.New(param.Name).Option("missingkey=zero").Parse(param.Value); err != nil {
+				return fmt.Errorf("the template of the %s parameter of %s builds is invalid: %w", param.Name, buildType, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pipelineRef returns the reference of the Pipeline running the build, the Pipeline shipped with the operator
+// unless another one is configured for the build type
+func pipelineRef(cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildRequest, configs map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig) *pipelinev1beta1.PipelineRef {
+	name := fmt.Sprintf("cre-%s", build.Pipeline)
+
+	ref := configs[cre.Spec.BuildType].PipelineRef
+	if ref == nil {
+		return &pipelinev1beta1.PipelineRef{Name: name}
+	}
+	if ref.Name != "" {
+		name = ref.Name
+	}
+
+	switch {
+	case ref.Resolver != "":
+		return &pipelinev1beta1.PipelineRef{ResolverRef: resolverRef(ref.Resolver, ref.ResolverParams)}
+	case ref.Bundle != "":
+		return &pipelinev1beta1.PipelineRef{Name: name, Bundle: ref.Bundle}
+	case ref.Namespace != "" && ref.Namespace != cre.Namespace:
+		return &pipelinev1beta1.PipelineRef{ResolverRef: resolverRef(clusterResolver, map[string]string{
+			"kind":      "pipeline",
+			"name":      name,
+			"namespace": ref.Namespace,
+		})}
+	}
+
+	return &pipelinev1beta1.PipelineRef{Name: name}
+}
+
+// resolverRef returns the reference to a Pipeline fetched by a Tekton resolver, its parameters sorted by name
+func resolverRef(resolver string, params map[string]string) pipelinev1beta1.ResolverRef {
+	ref := pipelinev1beta1.ResolverRef{Resolver: pipelinev1beta1.ResolverName(resolver)}
+	for name, value := range params {
+		ref.Resource = append(ref.Resource, pipelinev1beta1.ResolverParam{Name: name, Value: value})
+	}
+	sort.Slice(ref.Resource, func(i, j int) bool { return ref.Resource[i].Name < ref.Resource[j].Name })
+
+	return ref
+}
+
+// applyParamTemplates returns the parameters of the build with the ones configured for the build type added,
+// or replacing the ones of the same name
+func applyParamTemplates(cre *meteorv1alpha1.CustomRuntimeEnvironment, params []BuildParam, templates []meteorv1alpha1.ParamTemplate) ([]BuildParam, error) {
+	if len(templates) == 0 {
+		return params, nil
+	}
+
+	data := paramTemplateData{CustomRuntimeEnvironment: cre, Params: map[string]string{}}
+	for _, param := range params {
+		data.Params[param.Name] = param.Value
+		if param.Values != nil {
+			data.Params[param.Name] = strings.Join(param.Values, "\n")
+		}
+	}
+
+	applied := append([]BuildParam{}, params...)
+	for _, paramTemplate := range templates {
+		tmpl, err := template.New(paramTemplate.Name).Option("missingkey=zero").Parse(paramTemplate.Value)
+		if err != nil {
+			return nil, fmt.Errorf("the template of the %s parameter is invalid: %w", paramTemplate.Name, err)
+		}
+		value := &bytes.Buffer{}
+		if err := tmpl.Execute(value, data); err != nil {
+			return nil, fmt.Errorf("unable to evaluate the template of the %s parameter: %w", paramTemplate.Name, err)
+		}
+
+		param := BuildParam{Name: paramTemplate.Name, Value: value.String()}
+		replaced := false
+		for i := range applied {
+			if applied[i].Name == param.Name {
+				applied[i] = param
+				replaced = true
+			}
+		}
+		if !replaced {
+			applied = append(applied, param)
+		}
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"reflect"
+	"testing"
+
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestPipelineRef tests if the Pipeline configured for the build type is referenced, our own one otherwise
+func TestPipelineRef(t *testing.T) {
+	cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+			BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{BuildType: meteorv1alpha1.PackageList},
+		},
+	}
+	build := &BuildRequest{Name: "cre-test-1-package-list", Pipeline: "package-list"}
+
+	testCases := map[string]struct {
+		ref            *meteorv1alpha1.PipelineReference
+		expectedOutput pipelinev1beta1.PipelineRef
+	}{
+		"default": {
+			ref:            nil,
+			expectedOutput: pipelinev1beta1.PipelineRef{Name: "cre-package-list"},
+		},
+		"name": {
+			ref:            &meteorv1alpha1.PipelineReference{Name: "custom-package-list"},
+			expectedOutput: pipelinev1beta1.PipelineRef{Name: "custom-package-list"},
+		},
+		"same-namespace": {
+			ref:            &meteorv1alpha1.PipelineReference{Name: "custom-package-list", Namespace: "default"},
+			expectedOutput: pipelinev1beta1.PipelineRef{Name: "custom-package-list"},
+		},
+		"other-namespace": {
+			ref: &meteorv1alpha1.PipelineReference{Namespace: "meteor-pipelines"},
+			expectedOutput: pipelinev1beta1.PipelineRef{ResolverRef: pipelinev1beta1.ResolverRef{
+				Resolver: "cluster",
+				Resource: []pipelinev1beta1.ResolverParam{
+					{Name: "kind", Value: "pipeline"},
+					{Name: "name", Value: "cre-package-list"},
+					{Name: "namespace", Value: "meteor-pipelines"},
+				},
+			}},
+		},
+		"bundle": {
+			ref:            &meteorv1alpha1.PipelineReference{Bundle: "quay.io/thoth-station/cre-pipelines:v1"},
+			expectedOutput: pipelinev1beta1.PipelineRef{Name: "cre-package-list", Bundle: "quay.io/thoth-station/cre-pipelines:v1"},
+		},
+		"resolver": {
+			ref: &meteorv1alpha1.PipelineReference{
+				Resolver: "git",
+				ResolverParams: map[string]string{
+					"url":        "https://github.com/thoth-station/meteor-operator",
+					"pathInRepo": "pipelines/pipelines/cre-package-list.yaml",
+				},
+			},
+			expectedOutput: pipelinev1beta1.PipelineRef{ResolverRef: pipelinev1beta1.ResolverRef{
+				Resolver: "git",
+				Resource: []pipelinev1beta1.ResolverParam{
+					{Name: "pathInRepo", Value: "pipelines/pipelines/cre-package-list.yaml"},
+					{Name: "url", Value: "https://github.com/thoth-station/meteor-operator"},
+				},
+			}},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		configs := map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig{
+			meteorv1alpha1.PackageList: {PipelineRef: tc.ref},
+		}
+
+		if output := pipelineRef(cre, build, configs); !reflect.DeepEqual(*output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestApplyParamTemplates tests if the configured parameters are evaluated against the CustomRuntimeEnvironment
+func TestApplyParamTemplates(t *testing.T) {
+	cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Namespace:   "default",
+			Annotations: map[string]string{meteorv1alpha1.CRECreatorAnnotationKey: "ginkgo+gomega"},
+		},
+		Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+			BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+				BuildType:  meteorv1alpha1.GitRepository,
+				Repository: "https://github.com/AICoE/elyra-aidevsecops-tutorial",
+				GitRef:     "main",
+			},
+		},
+	}
+	params := []BuildParam{
+		{Name: "url", Value: "https://github.com/AICoE/elyra-aidevsecops-tutorial"},
+		{Name: "ref", Value: "main"},
+		{Name: "packages", Values: []string{"numpy", "pandas"}},
+	}
+
+	testCases := map[string]struct {
+		templates      []meteorv1alpha1.ParamTemplate
+		expectedOutput []BuildParam
+		expectedError  bool
+	}{
+		"no-templates": {
+			templates:      nil,
+			expectedOutput: params,
+		},
+		"added": {
+			templates: []meteorv1alpha1.ParamTemplate{
+				{Name: "requester", Value: `{{ index .Annotations "opendatahub.io/notebook-image-creator" }}`},
+				{Name: "packageCount", Value: "{{ len .Spec.PackageVersions }}"},
+			},
+			expectedOutput: append(append([]BuildParam{}, params...),
+				BuildParam{Name: "requester", Value: "ginkgo+gomega"},
+				BuildParam{Name: "packageCount", Value: "0"},
+			),
+		},
+		"replaced": {
+			templates: []meteorv1alpha1.ParamTemplate{
+				{Name: "url", Value: "{{ .Params.url }}.git"},
+				{Name: "packages", Value: "{{ .Params.packages }}"},
+			},
+			expectedOutput: []BuildParam{
+				{Name: "url", Value: "https://github.com/AICoE/elyra-aidevsecops-tutorial.git"},
+				{Name: "ref", Value: "main"},
+				{Name: "packages", Value: "numpy\npandas"},
+			},
+		},
+		"unknown-field": {
+			templates:     []meteorv1alpha1.ParamTemplate{{Name: "owner", Value: "{{ .Spec.Owner }}"}},
+			expectedError: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		output, err := applyParamTemplates(cre, params, tc.templates)
+		if tc.expectedError {
+			if err == nil {
+				t.Errorf("%s Got no error while expecting one", tcName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s Got error %v while expecting none", tcName, err)
+			continue
+		}
+		if !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestValidatePipelineConfigs tests if ambiguous Pipeline references and invalid templates are refused
+func TestValidatePipelineConfigs(t *testing.T) {
+	testCases := map[string]struct {
+		config        meteorv1alpha1.PipelineConfig
+		expectedError bool
+	}{
+		"valid": {
+			config: meteorv1alpha1.PipelineConfig{
+				PipelineRef: &meteorv1alpha1.PipelineReference{Bundle: "quay.io/thoth-station/cre-pipelines:v1"},
+				Params:      []meteorv1alpha1.ParamTemplate{{Name: "url", Value: "{{ .Spec.Repository }}"}},
+			},
+			expectedError: false,
+		},
+		"bundle-and-resolver": {
+			config: meteorv1alpha1.PipelineConfig{
+				PipelineRef: &meteorv1alpha1.PipelineReference{Bundle: "quay.io/thoth-station/cre-pipelines:v1", Resolver: "git"},
+			},
+			expectedError: true,
+		},
+		"invalid-template": {
+			config: meteorv1alpha1.PipelineConfig{
+				Params: []meteorv1alpha1.ParamTemplate{{Name: "url", Value: "{{ .Spec.Repository"}},
+			},
+			expectedError: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		configs := map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig{meteorv1alpha1.GitRepository: tc.config}
+
+		if err := validatePipelineConfigs(configs); (err != nil) != tc.expectedError {
+			t.Errorf("%s Got error %v while expecting an error: %v", tcName, err, tc.expectedError)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+const (
+	// queuedBuildRequeueAfter is the time after which a queued build checks again whether it can start, in case
+	// the event of a build finishing was missed
+	queuedBuildRequeueAfter = time.Minute
+
+	// admissionGracePeriod is the time an admitted build counts as running until the cache shows it running
+	admissionGracePeriod = time.Minute
+)
+
+// buildQueue remembers the builds it admitted until the cache shows them running, so that the builds admitted in a
+// row do not exceed the concurrency limits while the cache catches up
+type buildQueue struct {
+	mu       sync.Mutex
+	admitted map[types.NamespacedName]time.Time
+}
+
+// release forgets the admission of a build which could not be submitted, so that it does not hold its slot
+func (q *buildQueue) release(key types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.admitted, key)
+}
+
+// queueEntry is a CustomRuntimeEnvironment waiting for its build to be admitted
+type queueEntry struct {
+	key       types.NamespacedName
+	priority  int32
+	queuedAt  time.Time
+	createdAt time.Time
+}
+
+// admitBuild returns true if the build of the CustomRuntimeEnvironment may start within the concurrency limits of the
+// operator. It queues the build otherwise, the BuildQueued condition and the queue position record it then.
+func (r *CustomRuntimeEnvironmentReconciler) admitBuild(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) bool {
+	logger := log.FromContext(ctx)
+	limits := r.Concurrency
+	if limits.MaxBuilds <= 0 && limits.MaxBuildsPerNamespace <= 0 {
+		return true
+	}
+
+	r.queue.mu.Lock()
+	defer r.queue.mu.Unlock()
+	if r.queue.admitted == nil {
+		r.queue.admitted = map[types.NamespacedName]time.Time{}
+	}
+
+	opts := []client.ListOption{}
+	if limits.MaxBuilds <= 0 {
+		opts = append(opts, client.InNamespace(cre.Namespace))
+	}
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(ctx, cres, opts...); err != nil {
+		logger.Error(err, "Unable to list CustomRuntimeEnvironments, queueing build")
+		return false
+	}
+
+	now := time.Now()
+	self := types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name}
+	running := map[types.NamespacedName]bool{}
+	queued := []queueEntry{}
+	for _, item := range cres.Items {
+		key := types.NamespacedName{Namespace: item.Namespace, Name: item.Name}
+		if meta.IsStatusConditionTrue(item.Status.Conditions, meteorv1alpha1.PipelineRunCreated) {
+			running[key] = true
+			delete(r.queue.admitted, key)
+			continue
+		}
+		if condition := meta.FindStatusCondition(item.Status.Conditions, meteorv1alpha1.BuildQueued); key != self && condition != nil && condition.Status == metav1.ConditionTrue {
+			queued = append(queued, queueEntry{key: key, priority: item.Spec.Priority, queuedAt: condition.LastTransitionTime.Time, createdAt: item.CreationTimestamp.Time})
+		}
+	}
+	for key, admittedAt := range r.queue.admitted {
+		if now.Sub(admittedAt) > admissionGracePeriod {
+			delete(r.queue.admitted, key)
+			continue
+		}
+		running[key] = true
+	}
+
+	entry := queueEntry{key: self, priority: cre.Spec.Priority, queuedAt: now, createdAt: cre.CreationTimestamp.Time}
+	if condition := meta.FindStatusCondition(cre.Status.Conditions, meteorv1alpha1.BuildQueued); condition != nil && condition.Status == metav1.ConditionTrue {
+		entry.queuedAt = condition.LastTransitionTime.Time
+	}
+
+	admit, position := queuePosition(entry, queued, running, limits)
+	if admit {
+		if !running[self] {
+			logger.Info("Build admitted")
+			r.queue.admitted[self] = now
+		}
+		meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.BuildQueued)
+		cre.Status.QueuePosition = 0
+		return true
+	}
+
+	logger.Info("Build queued", "position", position)
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.BuildQueued,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ConcurrencyLimitReached",
+		Message:            fmt.Sprintf("The build waits for other builds to finish, it is at position %d of the queue.", position),
+	})
+	cre.Status.QueuePosition = position
+	return false
+}
+
+// queuePosition returns true if the build may start, given the builds running and the ones queued, and its position
+// in the queue otherwise. A build starts once the builds queued before it within the same limits have started.
+func queuePosition(entry queueEntry, queued []queueEntry, running map[types.NamespacedName]bool, limits meteorv1alpha1.BuildConcurrencyConfig) (bool, int32) {
+	if running[entry.key] {
+		return true, 0
+	}
+
+	runningInNamespace := 0
+	for key := range running {
+		if key.Namespace == entry.key.Namespace {
+			runningInNamespace++
+		}
+	}
+
+	aheadInNamespace, ahead := 0, 0
+	for _, other := range queued {
+		if other.key == entry.key || !queuedBefore(other, entry, limits.QueueOrder) {
+			continue
+		}
+		ahead++
+		if other.key.Namespace == entry.key.Namespace {
+			aheadInNamespace++
+		}
+	}
+
+	admit := true
+	if limits.MaxBuildsPerNamespace > 0 && runningInNamespace+aheadInNamespace >= int(limits.MaxBuildsPerNamespace) {
+		admit = false
+	}
+	if limits.MaxBuilds > 0 && len(running)+ahead >= int(limits.MaxBuilds) {
+		admit = false
+	}
+	if admit {
+		return true, 0
+	}
+
+	if limits.MaxBuilds > 0 {
+		return false, int32(ahead + 1)
+	}
+	return false, int32(aheadInNamespace + 1)
+}
+
+// queuedBefore returns true if the build of a starts before the one of b
+func queuedBefore(a, b queueEntry, order meteorv1alpha1.QueueOrder) bool {
+	if order == meteorv1alpha1.PriorityQueueOrder && a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if !a.queuedAt.Equal(b.queuedAt) {
+		return a.queuedAt.Before(b.queuedAt)
+	}
+	if !a.createdAt.Equal(b.createdAt) {
+		return a.createdAt.Before(b.createdAt)
+	}
+
+	return a.key.String() < b.key.String()
+}
+
+// queuedCustomRuntimeEnvironments maps a changed CustomRuntimeEnvironment, whose build may have finished, to the
+// CustomRuntimeEnvironments whose builds are queued, so they are admitted in turn
+func (r *CustomRuntimeEnvironmentReconciler) queuedCustomRuntimeEnvironments(obj client.Object) []reconcile.Request {
+	if r.Concurrency.MaxBuilds <= 0 && r.Concurrency.MaxBuildsPerNamespace <= 0 {
+		return nil
+	}
+	if cre, ok := obj.(*meteorv1alpha1.CustomRuntimeEnvironment); ok && meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.BuildQueued) {
+		return nil
+	}
+
+	opts := []client.ListOption{}
+	if r.Concurrency.MaxBuilds <= 0 {
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	}
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(context.Background(), cres, opts...); err != nil {
+		log.Log.Error(err, "Unable to list CustomRuntimeEnvironments")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, cre := range cres.Items {
+		if meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.BuildQueued) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name}})
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestQueuePosition tests if builds start while the builds running and the ones queued before them are within the
+// limits of their namespace and of the cluster, and which position they get in the queue otherwise
+func TestQueuePosition(t *testing.T) {
+	now := time.Now()
+	key := func(namespace, name string) types.NamespacedName {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	entry := func(namespace, name string, priority int32, queuedFor time.Duration) queueEntry {
+		return queueEntry{key: key(namespace, name), priority: priority, queuedAt: now.Add(-queuedFor)}
+	}
+
+	testCases := map[string]struct {
+		entry            queueEntry
+		queued           []queueEntry
+		running          []types.NamespacedName
+		limits           meteorv1alpha1.BuildConcurrencyConfig
+		expectedAdmit    bool
+		expectedPosition int32
+	}{
+		"below-namespace-limit": {
+			entry:         entry("class-a", "student-1", 0, 0),
+			running:       []types.NamespacedName{key("class-a", "student-2")},
+			limits:        meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 2},
+			expectedAdmit: true,
+		},
+		"namespace-limit-reached": {
+			entry:            entry("class-a", "student-1", 0, 0),
+			running:          []types.NamespacedName{key("class-a", "student-2"), key("class-a", "student-3")},
+			limits:           meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 2},
+			expectedAdmit:    false,
+			expectedPosition: 1,
+		},
+		"other-namespace-running": {
+			entry:         entry("class-a", "student-1", 0, 0),
+			running:       []types.NamespacedName{key("class-b", "student-2"), key("class-b", "student-3")},
+			limits:        meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 2},
+			expectedAdmit: true,
+		},
+		"queued-before": {
+			entry:            entry("class-a", "student-1", 0, time.Minute),
+			queued:           []queueEntry{entry("class-a", "student-2", 0, 2*time.Minute), entry("class-a", "student-3", 0, 0)},
+			running:          []types.NamespacedName{key("class-a", "student-4")},
+			limits:           meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 2},
+			expectedAdmit:    false,
+			expectedPosition: 2,
+		},
+		"head-of-queue": {
+			entry:         entry("class-a", "student-1", 0, 2*time.Minute),
+			queued:        []queueEntry{entry("class-a", "student-2", 0, time.Minute)},
+			running:       []types.NamespacedName{key("class-a", "student-4")},
+			limits:        meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 2},
+			expectedAdmit: true,
+		},
+		"cluster-limit-reached": {
+			entry:            entry("class-a", "student-1", 0, 0),
+			queued:           []queueEntry{entry("class-b", "student-2", 0, time.Minute)},
+			running:          []types.NamespacedName{key("class-b", "student-3")},
+			limits:           meteorv1alpha1.BuildConcurrencyConfig{MaxBuilds: 2, MaxBuildsPerNamespace: 2},
+			expectedAdmit:    false,
+			expectedPosition: 2,
+		},
+		"fifo-ignores-priority": {
+			entry:            entry("class-a", "student-1", 10, 0),
+			queued:           []queueEntry{entry("class-a", "student-2", 0, time.Minute)},
+			running:          []types.NamespacedName{key("class-a", "student-3")},
+			limits:           meteorv1alpha1.BuildConcurrencyConfig{MaxBuilds: 2},
+			expectedAdmit:    false,
+			expectedPosition: 2,
+		},
+		"priority": {
+			entry:         entry("class-a", "student-1", 10, 0),
+			queued:        []queueEntry{entry("class-a", "student-2", 0, time.Minute)},
+			running:       []types.NamespacedName{key("class-a", "student-3")},
+			limits:        meteorv1alpha1.BuildConcurrencyConfig{MaxBuilds: 2, QueueOrder: meteorv1alpha1.PriorityQueueOrder},
+			expectedAdmit: true,
+		},
+		"already-admitted": {
+			entry:         entry("class-a", "student-1", 0, 0),
+			running:       []types.NamespacedName{key("class-a", "student-1")},
+			limits:        meteorv1alpha1.BuildConcurrencyConfig{MaxBuildsPerNamespace: 1},
+			expectedAdmit: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		running := map[types.NamespacedName]bool{}
+		for _, key := range tc.running {
+			running[key] = true
+		}
+
+		admit, position := queuePosition(tc.entry, tc.queued, running, tc.limits)
+		if admit != tc.expectedAdmit || position != tc.expectedPosition {
+			t.Errorf("%s Got admit %v at position %d while expecting %v at position %d", tcName, admit, position, tc.expectedAdmit, tc.expectedPosition)
+		}
+	}
+}
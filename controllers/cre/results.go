@@ -0,0 +1,63 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// pipelineRunResults returns the string results reported by the PipelineRun, by name
+func pipelineRunResults(pipelineRun *pipelinev1beta1.PipelineRun) map[string]string {
+	results := map[string]string{}
+	for _, result := range pipelineRun.Status.PipelineResults {
+		if result.Value.Type == pipelinev1beta1.ParamTypeString {
+			results[result.Name] = result.Value.StringVal
+		}
+	}
+
+	return results
+}
+
+// imageStatusFromBuild returns the image produced by a successful build. Results not reported by
+// the build are derived from the conventions our builds follow: the ImageStream is named after the
+// build and the image is tagged 'latest'.
+func imageStatusFromBuild(cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildStatus) *meteorv1alpha1.ImageStatus {
+	image := &meteorv1alpha1.ImageStatus{
+		PullSpec:        build.Results[imageURLResult],
+		Digest:          build.Results[imageDigestResult],
+		ImageStreamName: build.Results[imageStreamNameResult],
+		ImageStreamTag:  build.Results[imageStreamTagResult],
+		BaseImage:       build.Results[baseImageResult],
+		BuildTime:       build.CompletionTime,
+	}
+
+	if image.PullSpec == "" && cre.Spec.BuildType == meteorv1alpha1.ImportImage {
+		image.PullSpec = cre.Spec.FromImage
+	}
+	if image.ImageStreamName == "" {
+		image.ImageStreamName = build.Name
+	}
+	if image.ImageStreamTag == "" {
+		image.ImageStreamTag = "latest"
+	}
+
+	return image
+}
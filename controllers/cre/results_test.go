@@ -0,0 +1,105 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+func stringResult(name, value string) pipelinev1beta1.PipelineRunResult {
+	return pipelinev1beta1.PipelineRunResult{
+		Name:  name,
+		Value: *pipelinev1beta1.NewArrayOrString(value),
+	}
+}
+
+// TestImageStatusFromPipelineRun tests if the image status is read from the named results of a PipelineRun
+func TestImageStatusFromPipelineRun(t *testing.T) {
+	completionTime := metav1.Now()
+
+	testCases := map[string]struct {
+		cre            meteorv1alpha1.CustomRuntimeEnvironment
+		results        []pipelinev1beta1.PipelineRunResult
+		expectedOutput meteorv1alpha1.ImageStatus
+	}{
+		"package-list": {
+			cre: meteorv1alpha1.CustomRuntimeEnvironment{
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{BuildType: meteorv1alpha1.PackageList},
+				},
+			},
+			results: []pipelinev1beta1.PipelineRunResult{
+				stringResult(imageDigestResult, "sha256:0123"),
+				stringResult(baseImageResult, "quay.io/thoth-station/s2i-custom-notebook"),
+				stringResult(imageURLResult, "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list"),
+			},
+			expectedOutput: meteorv1alpha1.ImageStatus{
+				PullSpec:        "image-registry.openshift-image-registry.svc:5000/default/cre-test-1-package-list",
+				Digest:          "sha256:0123",
+				ImageStreamName: "cre-test-1-package-list",
+				ImageStreamTag:  "latest",
+				BaseImage:       "quay.io/thoth-station/s2i-custom-notebook",
+				BuildTime:       &completionTime,
+			},
+		},
+		"import-without-results": {
+			cre: meteorv1alpha1.CustomRuntimeEnvironment{
+				Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{
+					BuildTypeSpec: meteorv1alpha1.BuildTypeSpec{
+						BuildType: meteorv1alpha1.ImportImage,
+						FromImage: "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+					},
+				},
+			},
+			results: []pipelinev1beta1.PipelineRunResult{},
+			expectedOutput: meteorv1alpha1.ImageStatus{
+				PullSpec:        "quay.io/thoth-station/s2i-minimal-py38-notebook:v0.2.2",
+				ImageStreamName: "cre-test-1-package-list",
+				ImageStreamTag:  "latest",
+				BuildTime:       &completionTime,
+			},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		pipelineRun := &pipelinev1beta1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "cre-test-1-package-list"},
+			Status: pipelinev1beta1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1beta1.PipelineRunStatusFields{
+					CompletionTime:  &completionTime,
+					PipelineResults: tc.results,
+				},
+			},
+		}
+
+		build := &BuildStatus{
+			Name:           pipelineRun.Name,
+			State:          BuildSucceeded,
+			Results:        pipelineRunResults(pipelineRun),
+			CompletionTime: pipelineRun.Status.CompletionTime,
+		}
+
+		if output := imageStatusFromBuild(&tc.cre, build); *output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
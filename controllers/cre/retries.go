@@ -0,0 +1,80 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"fmt"
+	"time"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// buildName returns the name of the build of the current generation of the CustomRuntimeEnvironment, rebuilt and
+// retried builds are told apart by their count
+func buildName(cre *meteorv1alpha1.CustomRuntimeEnvironment, pipeline string) string {
+	name := fmt.Sprintf("cre-%s-%d", cre.GetName(), cre.GetGeneration())
+	if cre.Status.Rebuilds > 0 {
+		name = fmt.Sprintf("%s-rebuild-%d", name, cre.Status.Rebuilds)
+	}
+	if cre.Status.Retries > 0 {
+		name = fmt.Sprintf("%s-retry-%d", name, cre.Status.Retries)
+	}
+
+	return fmt.Sprintf("%s-%s", name, pipeline)
+}
+
+// retryAfter returns true if the finished build has to be retried, either because the retry annotation requests it
+// or because the RetryPolicy retries its failure, and how long to wait before retrying it.
+func retryAfter(cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildStatus, requested bool) (bool, time.Duration) {
+	if build.State == BuildRunning {
+		return false, 0
+	}
+	if requested {
+		return true, 0
+	}
+
+	policy := cre.Spec.RetryPolicy
+	if build.State != BuildFailed || policy == nil || cre.Status.Retries+1 >= policy.MaxAttempts {
+		return false, 0
+	}
+	if !isTransientFailure(build.Failure) {
+		return false, 0
+	}
+
+	if build.CompletionTime == nil {
+		return true, 0
+	}
+	wait := cre.GetRetryBackoff(cre.Status.Retries+1) - time.Since(build.CompletionTime.Time)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return true, wait
+}
+
+// isTransientFailure returns true if the failure is none of the well-known failures of the build itself, which
+// fail again unless the spec changes, so that building again may succeed. Registry and network errors are transient
+// whichever step they failed.
+func isTransientFailure(failure *meteorv1alpha1.BuildFailure) bool {
+	if failure == nil || (isRegistryUnavailable(failure) && !isSecretMissing(failure)) {
+		return true
+	}
+
+	return failureCondition(failure) == nil
+}
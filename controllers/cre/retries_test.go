@@ -0,0 +1,203 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestBuildName tests if retried builds get a name of their own
+func TestBuildName(t *testing.T) {
+	testCases := map[string]struct {
+		retries        int32
+		rebuilds       int32
+		expectedOutput string
+	}{
+		"first-build": {
+			retries:        0,
+			expectedOutput: "cre-test-2-package-list",
+		},
+		"second-retry": {
+			retries:        2,
+			expectedOutput: "cre-test-2-retry-2-package-list",
+		},
+		"rebuild": {
+			rebuilds:       3,
+			expectedOutput: "cre-test-2-rebuild-3-package-list",
+		},
+		"retried-rebuild": {
+			retries:        1,
+			rebuilds:       3,
+			expectedOutput: "cre-test-2-rebuild-3-retry-1-package-list",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 2},
+			Status:     meteorv1alpha1.CustomRuntimeEnvironmentStatus{Retries: tc.retries, Rebuilds: tc.rebuilds},
+		}
+
+		if output := buildName(cre, "package-list"); output != tc.expectedOutput {
+			t.Errorf("%s Got %s while expecting %s", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestRetryAfter tests if finished builds are retried on request, and failed ones by the retry policy unless their
+// failure is well-known or they have been built too many times, once the backoff has passed
+func TestRetryAfter(t *testing.T) {
+	policy := &meteorv1alpha1.RetryPolicy{MaxAttempts: 3, Backoff: &metav1.Duration{Duration: time.Minute}}
+	justNow := metav1.Now()
+	longAgo := metav1.NewTime(justNow.Add(-time.Hour))
+
+	testCases := map[string]struct {
+		policy        *meteorv1alpha1.RetryPolicy
+		retries       int32
+		build         BuildStatus
+		requested     bool
+		expectedRetry bool
+		expectedWait  bool
+	}{
+		"running": {
+			policy:    policy,
+			build:     BuildStatus{State: BuildRunning},
+			requested: true,
+		},
+		"requested-after-success": {
+			build:         BuildStatus{State: BuildSucceeded, CompletionTime: &justNow},
+			requested:     true,
+			expectedRetry: true,
+		},
+		"requested-after-cancel": {
+			build:         BuildStatus{State: BuildCancelled, CompletionTime: &justNow},
+			requested:     true,
+			expectedRetry: true,
+		},
+		"failed-without-policy": {
+			build: BuildStatus{State: BuildFailed, CompletionTime: &longAgo},
+		},
+		"cancelled-with-policy": {
+			policy: policy,
+			build:  BuildStatus{State: BuildCancelled, CompletionTime: &longAgo},
+		},
+		"transient-failure": {
+			policy:        policy,
+			build:         BuildStatus{State: BuildFailed, CompletionTime: &longAgo, Failure: &meteorv1alpha1.BuildFailure{TaskName: "git-clone"}},
+			expectedRetry: true,
+		},
+		"transient-failure-backoff": {
+			policy:        policy,
+			build:         BuildStatus{State: BuildFailed, CompletionTime: &justNow},
+			expectedRetry: true,
+			expectedWait:  true,
+		},
+		"registry-failure": {
+			policy:        policy,
+			build:         BuildStatus{State: BuildFailed, CompletionTime: &longAgo, Failure: &meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "push", ExitCode: 125, Message: "Error: pushing image: 503 Service Unavailable"}},
+			expectedRetry: true,
+		},
+		"well-known-failure": {
+			policy: policy,
+			build:  BuildStatus{State: BuildFailed, CompletionTime: &longAgo, Failure: &meteorv1alpha1.BuildFailure{TaskName: "resolve-dependencies"}},
+		},
+		"max-attempts": {
+			policy:  policy,
+			retries: 2,
+			build:   BuildStatus{State: BuildFailed, CompletionTime: &longAgo},
+		},
+		"requested-after-max-attempts": {
+			policy:        policy,
+			retries:       2,
+			build:         BuildStatus{State: BuildFailed, CompletionTime: &longAgo},
+			requested:     true,
+			expectedRetry: true,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec:   meteorv1alpha1.CustomRuntimeEnvironmentSpec{RetryPolicy: tc.policy},
+			Status: meteorv1alpha1.CustomRuntimeEnvironmentStatus{Retries: tc.retries},
+		}
+
+		retry, wait := retryAfter(cre, &tc.build, tc.requested)
+		if retry != tc.expectedRetry || (wait > 0) != tc.expectedWait {
+			t.Errorf("%s Got retry %v after %s while expecting %v and waiting %v", tcName, retry, wait, tc.expectedRetry, tc.expectedWait)
+		}
+	}
+}
+
+// TestIsTransientFailure tests if registry and network errors are transient whichever step they failed, and the
+// well-known failures of the build itself are not
+func TestIsTransientFailure(t *testing.T) {
+	testCases := map[string]struct {
+		failure        *meteorv1alpha1.BuildFailure
+		expectedOutput bool
+	}{
+		"no-failure": {
+			expectedOutput: true,
+		},
+		"unknown": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "git-clone", StepName: "clone", ExitCode: 1},
+			expectedOutput: true,
+		},
+		"build-image": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "run", ExitCode: 1, Message: "error building at STEP \"RUN pip install graphviz\": exit status 1"},
+			expectedOutput: false,
+		},
+		"resolve-dependencies": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "resolve-dependencies", StepName: "resolve-packages", ExitCode: 2},
+			expectedOutput: false,
+		},
+		"push-timeout": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "push", ExitCode: 125, Message: "Error: writing blob: dial tcp 54.144.203.57:443: i/o timeout"},
+			expectedOutput: true,
+		},
+		"pull-tls-handshake-timeout": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "buildah", StepName: "from", ExitCode: 125, Message: "Error: initializing source docker://quay.io/thoth-station/s2i-custom-py38-notebook:latest: net/http: TLS handshake timeout"},
+			expectedOutput: true,
+		},
+		"pull-server-error": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "buildah", StepName: "from", ExitCode: 125, Message: "Error: reading manifest latest: received unexpected HTTP status: 500 Internal Server Error"},
+			expectedOutput: true,
+		},
+		"push-rate-limited": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "push", ExitCode: 125, Message: "Error: writing manifest: toomanyrequests: You have reached your pull rate limit"},
+			expectedOutput: true,
+		},
+		"index-unreachable": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "resolve-dependencies", StepName: "resolve-packages", ExitCode: 1, Message: "Failed to establish a new connection: [Errno -3] Temporary failure in name resolution"},
+			expectedOutput: true,
+		},
+		"unauthorized": {
+			failure:        &meteorv1alpha1.BuildFailure{TaskName: "build-image", StepName: "push", ExitCode: 125, Message: "Error: writing blob: unauthorized: access to the requested resource is not authorized"},
+			expectedOutput: false,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		if output := isTransientFailure(tc.failure); output != tc.expectedOutput {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
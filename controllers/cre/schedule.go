@@ -0,0 +1,90 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// reconcileSchedule starts a new build of the current generation of the CustomRuntimeEnvironment once its
+// rebuildSchedule is due, and returns how long to wait until it is due next, 0 if it is not due again.
+func (r *CustomRuntimeEnvironmentReconciler) reconcileSchedule(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) time.Duration {
+	logger := log.FromContext(ctx)
+
+	if cre.Spec.RebuildSchedule == "" {
+		cre.Status.NextScheduledBuildTime = nil
+		return 0
+	}
+	schedule, err := meteorv1alpha1.ParseSchedule(cre.Spec.RebuildSchedule)
+	if err != nil {
+		logger.Error(err, "Invalid rebuild schedule", "rebuildSchedule", cre.Spec.RebuildSchedule)
+		cre.Status.NextScheduledBuildTime = nil
+		return 0
+	}
+
+	now := metav1.Now()
+	due, next := scheduledBuildDue(schedule, cre.Status.NextScheduledBuildTime, cre.Status.Phase, now.Time)
+
+	var nextTime *metav1.Time
+	if !next.IsZero() {
+		nextTime = &metav1.Time{Time: next}
+	}
+
+	switch {
+	case due:
+		logger.Info("Starting scheduled build", "rebuildSchedule", cre.Spec.RebuildSchedule, "nextScheduledBuildTime", nextTime)
+		cre.ScheduleBuild(now, nextTime)
+	case cre.Status.NextScheduledBuildTime != nil && !next.Equal(cre.Status.NextScheduledBuildTime.Time):
+		logger.Info("Skipping scheduled build, the previous build has not finished yet", "phase", cre.Status.Phase)
+		cre.Status.NextScheduledBuildTime = nextTime
+	default:
+		cre.Status.NextScheduledBuildTime = nextTime
+	}
+
+	if nextTime == nil {
+		return 0
+	}
+
+	return next.Sub(now.Time)
+}
+
+// scheduledBuildDue returns true if the scheduled build of the given time is due, and the time the schedule is due
+// next. The first time is the one after now, and the builds which are due while the previous build has not finished
+// are skipped.
+func scheduledBuildDue(schedule *meteorv1alpha1.Schedule, next *metav1.Time, phase meteorv1alpha1.Phase, now time.Time) (bool, time.Time) {
+	if next == nil {
+		return false, schedule.Next(now)
+	}
+	if now.Before(next.Time) {
+		return false, next.Time
+	}
+
+	switch phase {
+	case meteorv1alpha1.PhaseSucceeded, meteorv1alpha1.PhaseFailed, meteorv1alpha1.PhaseCancelled:
+		return true, schedule.Next(now)
+	}
+
+	return false, schedule.Next(now)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestScheduledBuildDue tests if scheduled builds are started once they are due and the previous build has finished,
+// and when the schedule is due next
+func TestScheduledBuildDue(t *testing.T) {
+	schedule, err := meteorv1alpha1.ParseSchedule("@daily")
+	if err != nil {
+		t.Fatalf("Got error %v while expecting none", err)
+	}
+	now := time.Date(2022, time.August, 17, 10, 20, 30, 0, time.UTC)
+	today := metav1.NewTime(time.Date(2022, time.August, 17, 0, 0, 0, 0, time.UTC))
+	tomorrow := metav1.NewTime(time.Date(2022, time.August, 18, 0, 0, 0, 0, time.UTC))
+
+	testCases := map[string]struct {
+		next         *metav1.Time
+		phase        meteorv1alpha1.Phase
+		expectedDue  bool
+		expectedNext time.Time
+	}{
+		"first-time": {
+			phase:        meteorv1alpha1.PhaseSucceeded,
+			expectedDue:  false,
+			expectedNext: tomorrow.Time,
+		},
+		"not-due": {
+			next:         &tomorrow,
+			phase:        meteorv1alpha1.PhaseSucceeded,
+			expectedDue:  false,
+			expectedNext: tomorrow.Time,
+		},
+		"due": {
+			next:         &today,
+			phase:        meteorv1alpha1.PhaseSucceeded,
+			expectedDue:  true,
+			expectedNext: tomorrow.Time,
+		},
+		"due-after-failure": {
+			next:         &today,
+			phase:        meteorv1alpha1.PhaseFailed,
+			expectedDue:  true,
+			expectedNext: tomorrow.Time,
+		},
+		"due-while-running": {
+			next:         &today,
+			phase:        meteorv1alpha1.PhaseRunning,
+			expectedDue:  false,
+			expectedNext: tomorrow.Time,
+		},
+		"due-while-queued": {
+			next:         &today,
+			phase:        meteorv1alpha1.PhaseQueued,
+			expectedDue:  false,
+			expectedNext: tomorrow.Time,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		due, next := scheduledBuildDue(schedule, tc.next, tc.phase, now)
+
+		if due != tc.expectedDue {
+			t.Errorf("%s Got due %v while expecting %v", tcName, due, tc.expectedDue)
+		}
+		if !next.Equal(tc.expectedNext) {
+			t.Errorf("%s Got next scheduled build time %v while expecting %v", tcName, next, tc.expectedNext)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// buildSecrets returns the names of the secrets the build clones the repository and pulls images with, empty if
+// they are not needed. It returns false if one of them is not available, the RequiredSecretMissing condition records
+// why then.
+func (r *CustomRuntimeEnvironmentReconciler) buildSecrets(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment) (string, string, bool) {
+	gitSecret := ""
+	if cre.Spec.GitSecret != nil {
+		gitSecret = cre.Spec.GitSecret.Name
+		if !r.requireSecret(ctx, cre, gitSecret, "GitSecret", "clone the repository", meteorv1alpha1.GitSecretTypes...) {
+			return "", "", false
+		}
+	}
+
+	imagePullSecret := cre.Spec.ImagePullSecret.Name
+	if imagePullSecret != "" {
+		if !r.requireSecret(ctx, cre, imagePullSecret, "ImagePullSecret", "pull the image", v1.SecretTypeDockerConfigJson) {
+			return "", "", false
+		}
+	}
+
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.RequiredSecretMissing)
+	return gitSecret, imagePullSecret, true
+}
+
+// requireSecret returns true if the named secret exists in the namespace of the CustomRuntimeEnvironment and is of
+// one of the secret types, the RequiredSecretMissing condition records why it is not available otherwise
+func (r *CustomRuntimeEnvironmentReconciler) requireSecret(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, name, kind, purpose string, secretTypes ...v1.SecretType) bool {
+	secret := &v1.Secret{}
+	err := r.APIReader.Get(ctx, types.NamespacedName{Name: name, Namespace: cre.Namespace}, secret)
+	if err == nil {
+		for _, secretType := range secretTypes {
+			if secret.Type == secretType {
+				return true
+			}
+		}
+	}
+
+	reason := "Invalid" + kind
+	message := fmt.Sprintf("secret %s required to %s is of type %s, not %s", name, purpose, secret.Type, joinSecretTypes(secretTypes))
+	switch {
+	case errors.IsNotFound(err):
+		reason = kind + "NotFound"
+		message = fmt.Sprintf("secret %s required to %s does not exist", name, purpose)
+	case err != nil:
+		reason = kind + "Unavailable"
+		message = fmt.Sprintf("unable to read secret %s required to %s: %s", name, purpose, err)
+	}
+	log.FromContext(ctx).Error(err, "Secret is not available", "secret", name, "reason", reason)
+
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.RequiredSecretMissing,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+	})
+	return false
+}
+
+// joinSecretTypes lists the secret types for messages, e.g. "kubernetes.io/ssh-auth or kubernetes.io/basic-auth"
+func joinSecretTypes(secretTypes []v1.SecretType) string {
+	names := make([]string, len(secretTypes))
+	for i, secretType := range secretTypes {
+		names[i] = string(secretType)
+	}
+
+	return strings.Join(names, " or ")
+}
+
+// secretMissingCustomRuntimeEnvironments maps a changed Secret to the CustomRuntimeEnvironments of its namespace
+// which are waiting for it to build, so they are retried
+func (r *CustomRuntimeEnvironmentReconciler) secretMissingCustomRuntimeEnvironments(secret client.Object) []reconcile.Request {
+	logger := log.Log.WithValues("secret", types.NamespacedName{Name: secret.GetName(), Namespace: secret.GetNamespace()})
+
+	cres := &meteorv1alpha1.CustomRuntimeEnvironmentList{}
+	if err := r.List(context.Background(), cres, client.InNamespace(secret.GetNamespace())); err != nil {
+		logger.Error(err, "Unable to list CustomRuntimeEnvironments")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, cre := range cres.Items {
+		usesSecret := cre.Spec.ImagePullSecret.Name == secret.GetName() ||
+			(cre.Spec.GitSecret != nil && cre.Spec.GitSecret.Name == secret.GetName())
+		if usesSecret && meta.IsStatusConditionTrue(cre.Status.Conditions, meteorv1alpha1.RequiredSecretMissing) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cre.Namespace, Name: cre.Name}})
+		}
+	}
+
+	return requests
+}
@@ -19,7 +19,6 @@ package cre
 import (
 	"context"
 	"fmt"
-	"go/build"
 	"os"
 	"path/filepath"
 	"testing"
@@ -28,7 +27,7 @@ import (
 	"github.com/onsi/ginkgo/v2/reporters"
 	"github.com/onsi/ginkgo/v2/types"
 	. "github.com/onsi/gomega"
-	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	imagev1 "github.com/openshift/api/image/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -64,13 +63,12 @@ var _ = BeforeSuite(func() {
 	ctx, cancel = context.WithCancel(context.TODO())
 
 	By("bootstrapping test environment")
-	err = pipelinev1beta1.AddToScheme(scheme.Scheme)
+	err = imagev1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths: []string{
-			filepath.Join("..", "..", "config", "crd", "bases"),
-			filepath.Join(build.Default.GOPATH, "pkg", "mod", "github.com", "tektoncd", "pipeline@v0.38.3", "config")},
+		// the builds are run as Jobs, so the Tekton CRDs are not needed
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
 	}
 
@@ -94,8 +92,17 @@ var _ = BeforeSuite(func() {
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&CustomRuntimeEnvironmentReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: k8sManager.GetScheme(),
+		Client:    k8sManager.GetClient(),
+		Scheme:    k8sManager.GetScheme(),
+		APIReader: k8sManager.GetAPIReader(),
+		Backends: map[meteorv1alpha1.BuildBackend]BuildBackend{
+			meteorv1alpha1.JobBuildBackend: &jobBackend{
+				Client:    k8sManager.GetClient(),
+				Scheme:    k8sManager.GetScheme(),
+				APIReader: k8sManager.GetAPIReader(),
+			},
+		},
+		DefaultBuildBackend: meteorv1alpha1.JobBuildBackend,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,268 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/pod"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// tektonBackend runs the builds as PipelineRuns of our cre-<pipeline> Pipelines, or the ones configured instead
+type tektonBackend struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader reads the objects not cached, such as the TaskRuns and workspaces of the PipelineRuns
+	APIReader client.Reader
+	// Pipelines customizes the Pipelines running the builds, by build type
+	Pipelines map[meteorv1alpha1.BuildType]meteorv1alpha1.PipelineConfig
+}
+
+// SetupWithManager indexes the PipelineRuns by their owner and watches them
+func (b *tektonBackend) SetupWithManager(mgr ctrl.Manager, bldr *builder.Builder) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &pipelinev1beta1.PipelineRun{}, buildOwnerKey, indexBuildOwner); err != nil {
+		return err
+	}
+	bldr.Owns(&pipelinev1beta1.PipelineRun{})
+
+	return nil
+}
+
+// Submit creates the PipelineRun of the build
+func (b *tektonBackend) Submit(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, build *BuildRequest) error {
+	params := []pipelinev1beta1.Param{}
+	for _, param := range build.Params {
+		value := pipelinev1beta1.ArrayOrString{Type: pipelinev1beta1.ParamTypeString, StringVal: param.Value}
+		if param.Values != nil {
+			value = pipelinev1beta1.ArrayOrString{Type: pipelinev1beta1.ParamTypeArray, ArrayVal: param.Values}
+		}
+		params = append(params, pipelinev1beta1.Param{Name: param.Name, Value: value})
+	}
+
+	pipelineRun := &pipelinev1beta1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      build.Name,
+			Namespace: cre.Namespace,
+			Labels: map[string]string{
+				pipelineLabelKey:   build.Pipeline,
+				generationLabelKey: strconv.FormatInt(cre.GetGeneration(), 10),
+			},
+		},
+		Spec: pipelinev1beta1.PipelineRunSpec{
+			PipelineRef: pipelineRef(cre, build, b.Pipelines),
+			Params:      params,
+			Workspaces:  tektonWorkspaces(build),
+		},
+	}
+	if build.Timeout > 0 {
+		pipelineRun.Spec.Timeouts = &pipelinev1beta1.TimeoutFields{Pipeline: &metav1.Duration{Duration: build.Timeout}}
+	}
+	// the secret pulls the images run as steps, e.g. by the validation of an imported image
+	if build.ImagePullSecret != "" {
+		pipelineRun.Spec.PodTemplate = &pod.Template{
+			ImagePullSecrets: []v1.LocalObjectReference{{Name: build.ImagePullSecret}},
+		}
+	}
+	if err := controllerutil.SetControllerReference(cre, pipelineRun, b.Scheme); err != nil {
+		return err
+	}
+
+	return b.Create(ctx, pipelineRun)
+}
+
+// Status returns the status of the PipelineRun of the build
+func (b *tektonBackend) Status(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, name string) (*BuildStatus, error) {
+	pipelineRun := &pipelinev1beta1.PipelineRun{}
+	if err := b.Get(ctx, types.NamespacedName{Name: name, Namespace: cre.Namespace}, pipelineRun); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	status := &BuildStatus{
+		Name:           name,
+		State:          BuildRunning,
+		StartTime:      &pipelineRun.CreationTimestamp,
+		CompletionTime: pipelineRun.Status.CompletionTime,
+	}
+	if len(pipelineRun.Status.Conditions) > 1 { // TODO observe tekton project if they stay with just one condition all the time
+		log.FromContext(ctx).Error(nil, "Tekton reported multiple conditions", "pipelinerun", pipelineRun.GetNamespacedName())
+	}
+
+	if len(pipelineRun.Status.Conditions) > 0 && pipelineRun.Status.Conditions[0].Type == "Succeeded" {
+		condition := pipelineRun.Status.Conditions[0]
+		switch condition.Status {
+		case v1.ConditionTrue:
+			status.State = BuildSucceeded
+			status.Results = pipelineRunResults(pipelineRun)
+			return status, nil
+		case v1.ConditionFalse:
+			if pipelineRun.IsCancelled() {
+				status.State = BuildCancelled
+				return status, nil
+			}
+			status.State = BuildFailed
+			status.TimedOut = condition.Reason == pipelinev1beta1.PipelineRunReasonTimedOut.String()
+			failure, err := b.failure(ctx, pipelineRun)
+			if err != nil {
+				return nil, err
+			}
+			status.Failure = failure
+			return status, nil
+		}
+	}
+
+	taskRuns := &pipelinev1beta1.TaskRunList{}
+	if err := b.APIReader.List(ctx, taskRuns, client.InNamespace(pipelineRun.Namespace), client.MatchingLabels{pipeline.PipelineRunLabelKey: pipelineRun.Name}); err != nil {
+		return nil, fmt.Errorf("unable to list TaskRuns of PipelineRun: %w", err)
+	}
+	status.Pending = !taskRunsStarted(taskRuns.Items)
+
+	return status, nil
+}
+
+// taskRunsStarted returns true once a step of one of the TaskRuns has started
+func taskRunsStarted(taskRuns []pipelinev1beta1.TaskRun) bool {
+	for _, taskRun := range taskRuns {
+		for _, step := range taskRun.Status.Steps {
+			if step.Running != nil || step.Terminated != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// failure inspects the TaskRuns of a failed PipelineRun to find the failed step
+func (b *tektonBackend) failure(ctx context.Context, pipelineRun *pipelinev1beta1.PipelineRun) (*meteorv1alpha1.BuildFailure, error) {
+	taskRuns := &pipelinev1beta1.TaskRunList{}
+	if err := b.APIReader.List(ctx, taskRuns, client.InNamespace(pipelineRun.Namespace), client.MatchingLabels{pipeline.PipelineRunLabelKey: pipelineRun.Name}); err != nil {
+		return nil, fmt.Errorf("unable to list TaskRuns of failed PipelineRun: %w", err)
+	}
+
+	failure := failureFromTaskRuns(taskRuns.Items)
+	if failure == nil {
+		// the PipelineRun failed before any of its tasks did, e.g. the Pipeline could not be found
+		failure = &meteorv1alpha1.BuildFailure{}
+		if len(pipelineRun.Status.Conditions) > 0 {
+			failure.Reason = pipelineRun.Status.Conditions[0].Reason
+			failure.Message = pipelineRun.Status.Conditions[0].Message
+		}
+	}
+
+	return failure, nil
+}
+
+// Cancel cancels the PipelineRuns not retained which are still running
+func (b *tektonBackend) Cancel(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) error {
+	logger := log.FromContext(ctx)
+
+	pipelineRuns := &pipelinev1beta1.PipelineRunList{}
+	if err := b.List(ctx, pipelineRuns, client.InNamespace(cre.Namespace), client.MatchingFields{buildOwnerKey: cre.Name}); err != nil {
+		return err
+	}
+
+	for i := range pipelineRuns.Items {
+		pipelineRun := &pipelineRuns.Items[i]
+		if pipelineRun.IsDone() || pipelineRun.IsCancelled() {
+			continue
+		}
+		if !isDiscarded(pipelineRun, retain) {
+			continue
+		}
+
+		logger.Info("Cancelling PipelineRun", "pipelinerun", pipelineRun.GetNamespacedName())
+		patch := client.MergeFrom(pipelineRun.DeepCopy())
+		pipelineRun.Spec.Status = pipelinev1beta1.PipelineRunSpecStatusCancelled
+		if err := b.Patch(ctx, pipelineRun, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cleanup deletes the PipelineRuns not retained and the workspace PersistentVolumeClaims they own
+func (b *tektonBackend) Cleanup(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, retain func(name string, generation int64) bool) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	pipelineRuns := &pipelinev1beta1.PipelineRunList{}
+	if err := b.List(ctx, pipelineRuns, client.InNamespace(cre.Namespace), client.MatchingFields{buildOwnerKey: cre.Name}); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	deleted := map[types.UID]bool{}
+	for i := range pipelineRuns.Items {
+		pipelineRun := &pipelineRuns.Items[i]
+		if !isDiscarded(pipelineRun, retain) {
+			continue
+		}
+
+		logger.Info("Deleting PipelineRun", "pipelinerun", pipelineRun.GetNamespacedName())
+		if err := b.Delete(ctx, pipelineRun, client.PropagationPolicy("Background")); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		names = append(names, pipelineRun.Name)
+		deleted[pipelineRun.UID] = true
+	}
+	if len(deleted) == 0 {
+		return names, nil
+	}
+
+	for _, name := range names {
+		claims := &v1.PersistentVolumeClaimList{}
+		if err := b.APIReader.List(ctx, claims, client.InNamespace(cre.Namespace), client.MatchingLabels{buildLabelKey: name}); err != nil {
+			return nil, err
+		}
+		for i := range claims.Items {
+			claim := &claims.Items[i]
+			for _, owner := range claim.OwnerReferences {
+				if !deleted[owner.UID] {
+					continue
+				}
+				logger.Info("Deleting workspace of PipelineRun", "persistentvolumeclaim", claim.Name, "pipelinerun", owner.Name)
+				if err := b.Delete(ctx, claim); err != nil && !errors.IsNotFound(err) {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// buildTimeout returns the time the build of the CustomRuntimeEnvironment may take, its own build timeout
+// overrides the one of the operator, which overrides our default
+func (r *CustomRuntimeEnvironmentReconciler) buildTimeout(cre *meteorv1alpha1.CustomRuntimeEnvironment) time.Duration {
+	switch {
+	case cre.Spec.BuildTimeout != nil:
+		return cre.Spec.BuildTimeout.Duration
+	case r.BuildTimeout != nil:
+		return r.BuildTimeout.Duration
+	}
+
+	return meteorv1alpha1.DefaultBuildTimeout
+}
+
+// buildPendingTimeout returns the time a build may wait for its first step to start
+func (r *CustomRuntimeEnvironmentReconciler) buildPendingTimeout() time.Duration {
+	if r.BuildPendingTimeout != nil {
+		return r.BuildPendingTimeout.Duration
+	}
+
+	return meteorv1alpha1.DefaultBuildPendingTimeout
+}
+
+// watchBuild cancels the running build once it has run longer than its build timeout, or has been pending longer
+// than the operator allows, and returns when to check it again otherwise. The backends stop the builds which run
+// too long themselves, but they may not count the time the build waits to be scheduled.
+func (r *CustomRuntimeEnvironmentReconciler) watchBuild(ctx context.Context, cre *meteorv1alpha1.CustomRuntimeEnvironment, backend BuildBackend, build *BuildStatus, statusIndex int) ctrl.Result {
+	logger := log.FromContext(ctx).WithValues("build", build.Name)
+
+	condition, wait := buildDeadline(build, r.buildTimeout(cre), r.buildPendingTimeout(), time.Now())
+	if condition == nil {
+		return ctrl.Result{RequeueAfter: wait}
+	}
+
+	logger.Info("Cancelling build which timed out", "reason", condition.Reason)
+	if err := backend.Cancel(ctx, cre, nil); err != nil {
+		logger.Error(err, "Unable to cancel build")
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               meteorv1alpha1.GenericPipelineError,
+			Status:             metav1.ConditionTrue,
+			Reason:             "PipelineRunCancelFailed",
+			Message:            err.Error(),
+		})
+		return ctrl.Result{}
+	}
+
+	setBuildTimedOut(cre, statusIndex, build, condition)
+	return ctrl.Result{}
+}
+
+// buildDeadline returns the BuildTimedOut condition if the running build has exceeded the timeout, or the pending
+// timeout while none of its steps has started, and the time left until it would otherwise
+func buildDeadline(build *BuildStatus, timeout, pendingTimeout time.Duration, now time.Time) (*metav1.Condition, time.Duration) {
+	if build.StartTime == nil || build.StartTime.IsZero() {
+		return nil, 0
+	}
+	elapsed := now.Sub(build.StartTime.Time)
+
+	wait := timeout - elapsed
+	if wait <= 0 {
+		return &metav1.Condition{
+			Type:    meteorv1alpha1.BuildTimedOut,
+			Status:  metav1.ConditionTrue,
+			Reason:  "BuildTimeout",
+			Message: fmt.Sprintf("The build has run longer than its build timeout of %s.", timeout),
+		}, 0
+	}
+
+	if build.Pending {
+		pendingWait := pendingTimeout - elapsed
+		if pendingWait <= 0 {
+			return &metav1.Condition{
+				Type:    meteorv1alpha1.BuildTimedOut,
+				Status:  metav1.ConditionTrue,
+				Reason:  "BuildPendingTimeout",
+				Message: fmt.Sprintf("No step of the build has started within %s, its workspace may not be bound or its images may not be pulled.", pendingTimeout),
+			}, 0
+		}
+		if pendingWait < wait {
+			wait = pendingWait
+		}
+	}
+
+	return nil, wait
+}
+
+// setBuildTimedOut records that the build of the current generation has failed because it timed out
+func setBuildTimedOut(cre *meteorv1alpha1.CustomRuntimeEnvironment, statusIndex int, build *BuildStatus, condition *metav1.Condition) {
+	condition.ObservedGeneration = cre.Generation
+	meta.SetStatusCondition(&cre.Status.Conditions, *condition)
+	meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+		ObservedGeneration: cre.Generation,
+		Type:               meteorv1alpha1.PipelineRunCompleted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PipelineRunTimeout",
+		Message:            "The PipelineRun has timed out.",
+	})
+	meta.RemoveStatusCondition(&cre.Status.Conditions, meteorv1alpha1.PipelineRunCreated)
+
+	if buildCondition, ok := meteorv1alpha1.BuildConditions[cre.Spec.BuildType]; ok {
+		meta.SetStatusCondition(&cre.Status.Conditions, metav1.Condition{
+			ObservedGeneration: cre.Generation,
+			Type:               buildCondition.Type,
+			Status:             metav1.ConditionFalse,
+			Reason:             buildCondition.FailedReason,
+			Message:            buildCondition.FailedMessage,
+		})
+	}
+
+	cre.Status.Pipelines[statusIndex].Ready = "False"
+	cre.Status.Failure = &meteorv1alpha1.BuildFailure{
+		PipelineRunName: build.Name,
+		Reason:          condition.Reason,
+		Message:         condition.Message,
+	}
+}
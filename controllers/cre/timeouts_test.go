@@ -0,0 +1,115 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// TestBuildTimeout tests if the build timeout of the CustomRuntimeEnvironment overrides the one of the operator,
+// which overrides our default
+func TestBuildTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		operator       *metav1.Duration
+		cre            *metav1.Duration
+		expectedOutput time.Duration
+	}{
+		"default": {
+			expectedOutput: meteorv1alpha1.DefaultBuildTimeout,
+		},
+		"operator": {
+			operator:       &metav1.Duration{Duration: 2 * time.Hour},
+			expectedOutput: 2 * time.Hour,
+		},
+		"cre": {
+			operator:       &metav1.Duration{Duration: 2 * time.Hour},
+			cre:            &metav1.Duration{Duration: 30 * time.Minute},
+			expectedOutput: 30 * time.Minute,
+		},
+	}
+
+	for tcName, tc := range testCases {
+		r := &CustomRuntimeEnvironmentReconciler{BuildTimeout: tc.operator}
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{BuildTimeout: tc.cre},
+		}
+
+		if output := r.buildTimeout(cre); output != tc.expectedOutput {
+			t.Errorf("%s Got %s while expecting %s", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestBuildDeadline tests if running builds time out after the build timeout, and pending ones after the pending
+// timeout, and when they are checked again otherwise
+func TestBuildDeadline(t *testing.T) {
+	now := time.Now()
+	startedAt := func(elapsed time.Duration) *metav1.Time {
+		startTime := metav1.NewTime(now.Add(-elapsed))
+		return &startTime
+	}
+
+	testCases := map[string]struct {
+		build          BuildStatus
+		expectedReason string
+		expectedWait   time.Duration
+	}{
+		"running": {
+			build:        BuildStatus{StartTime: startedAt(20 * time.Minute)},
+			expectedWait: 40 * time.Minute,
+		},
+		"running-too-long": {
+			build:          BuildStatus{StartTime: startedAt(time.Hour)},
+			expectedReason: "BuildTimeout",
+		},
+		"pending": {
+			build:        BuildStatus{StartTime: startedAt(5 * time.Minute), Pending: true},
+			expectedWait: 5 * time.Minute,
+		},
+		"pending-too-long": {
+			build:          BuildStatus{StartTime: startedAt(10 * time.Minute), Pending: true},
+			expectedReason: "BuildPendingTimeout",
+		},
+		"started-after-pending-timeout": {
+			build:        BuildStatus{StartTime: startedAt(15 * time.Minute)},
+			expectedWait: 45 * time.Minute,
+		},
+		"no-start-time": {
+			build: BuildStatus{Pending: true},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		condition, wait := buildDeadline(&tc.build, time.Hour, 10*time.Minute, now)
+
+		reason := ""
+		if condition != nil {
+			reason = condition.Reason
+			if condition.Type != meteorv1alpha1.BuildTimedOut || condition.Status != metav1.ConditionTrue {
+				t.Errorf("%s Got condition %v", tcName, condition)
+			}
+		}
+		if reason != tc.expectedReason || wait != tc.expectedWait {
+			t.Errorf("%s Got reason %q and wait %s while expecting %q and %s", tcName, reason, wait, tc.expectedReason, tc.expectedWait)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cre
+
+import (
+	"reflect"
+
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+// buildWorkspace returns the workspace of the builds of the CustomRuntimeEnvironment, its settings override the
+// ones of the operator configuration, which override our defaults of ReadWriteOnce 500Mi
+func (r *CustomRuntimeEnvironmentReconciler) buildWorkspace(cre *meteorv1alpha1.CustomRuntimeEnvironment) meteorv1alpha1.WorkspaceSpec {
+	workspace := meteorv1alpha1.WorkspaceSpec{
+		VolumeClaimTemplate: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: resource.MustParse(defaultWorkspaceSize),
+				},
+			},
+		},
+	}
+
+	for _, override := range []*meteorv1alpha1.WorkspaceSpec{&r.Workspace, cre.Spec.Workspace} {
+		if override == nil {
+			continue
+		}
+
+		template := override.VolumeClaimTemplate
+		if len(template.AccessModes) != 0 {
+			workspace.VolumeClaimTemplate.AccessModes = template.AccessModes
+		}
+		if !reflect.ValueOf(template.Resources).IsZero() {
+			workspace.VolumeClaimTemplate.Resources = template.Resources
+		}
+		if template.StorageClassName != nil {
+			workspace.VolumeClaimTemplate.StorageClassName = template.StorageClassName
+		}
+
+		// an existing claim replaces the claims created per build, unless a more specific setting asks for them again
+		if override.ClaimName != "" {
+			workspace.ClaimName = override.ClaimName
+		} else if !reflect.ValueOf(template).IsZero() {
+			workspace.ClaimName = ""
+		}
+	}
+
+	return workspace
+}
+
+// buildCABundle returns the CA bundle of the builds of the CustomRuntimeEnvironment, nil for the OpenShift service CA
+func (r *CustomRuntimeEnvironmentReconciler) buildCABundle(cre *meteorv1alpha1.CustomRuntimeEnvironment) *meteorv1alpha1.ConfigMapKeyReference {
+	if cre.Spec.CABundle != nil {
+		return cre.Spec.CABundle
+	}
+
+	return r.CABundle
+}
+
+// caBundleVolumeSource returns the ConfigMap volume holding the CA bundle as ca.crt. The OpenShift service CA
+// is optional, so the builds still run on clusters without it.
+func caBundleVolumeSource(caBundle *meteorv1alpha1.ConfigMapKeyReference) *v1.ConfigMapVolumeSource {
+	optional := caBundle == nil
+	if optional {
+		caBundle = &meteorv1alpha1.ConfigMapKeyReference{Name: defaultCABundleConfigMap, Key: defaultCABundleKey}
+	}
+
+	return &v1.ConfigMapVolumeSource{
+		LocalObjectReference: v1.LocalObjectReference{
+			Name: caBundle.Name,
+		},
+		Items: []v1.KeyToPath{{
+			Key:  caBundle.Key,
+			Path: "ca.crt",
+		}},
+		DefaultMode: pointer.Int32(420),
+		Optional:    pointer.Bool(optional),
+	}
+}
+
+// registryCredentialsVolumeSource returns the volume holding the dockerconfigjson secret as config.json, the
+// builds point REGISTRY_AUTH_FILE at it
+func registryCredentialsVolumeSource(secret string) *v1.SecretVolumeSource {
+	return &v1.SecretVolumeSource{
+		SecretName: secret,
+		Items: []v1.KeyToPath{{
+			Key:  v1.DockerConfigJsonKey,
+			Path: "config.json",
+		}},
+	}
+}
+
+// tektonWorkspaces returns the workspaces of the PipelineRun of the build
+func tektonWorkspaces(build *BuildRequest) []pipelinev1beta1.WorkspaceBinding {
+	data := pipelinev1beta1.WorkspaceBinding{Name: "data"}
+	if build.Workspace.ClaimName != "" {
+		data.PersistentVolumeClaim = &v1.PersistentVolumeClaimVolumeSource{ClaimName: build.Workspace.ClaimName}
+		data.SubPath = build.Name
+	} else {
+		data.VolumeClaimTemplate = &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{buildLabelKey: build.Name}},
+			Spec:       *build.Workspace.VolumeClaimTemplate.DeepCopy(),
+		}
+	}
+
+	workspaces := []pipelinev1beta1.WorkspaceBinding{
+		data,
+		{
+			Name:      "sslcertdir",
+			ConfigMap: caBundleVolumeSource(build.CABundle),
+		},
+	}
+	if build.GitSecret != "" {
+		workspaces = append(workspaces, pipelinev1beta1.WorkspaceBinding{
+			Name:   "git-credentials",
+			Secret: &v1.SecretVolumeSource{SecretName: build.GitSecret},
+		})
+	}
+	if build.ImagePullSecret != "" {
+		workspaces = append(workspaces, pipelinev1beta1.WorkspaceBinding{
+			Name:   "registry-credentials",
+			Secret: registryCredentialsVolumeSource(build.ImagePullSecret),
+		})
+	}
+
+	return workspaces
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021, 2022 The Meteor Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cre
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/pointer"
+
+	meteorv1alpha1 "github.com/thoth-station/meteor-operator/api/v1alpha1"
+)
+
+func claimTemplate(accessMode v1.PersistentVolumeAccessMode, size string, storageClass *string) v1.PersistentVolumeClaimSpec {
+	return v1.PersistentVolumeClaimSpec{
+		AccessModes: []v1.PersistentVolumeAccessMode{accessMode},
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+		},
+		StorageClassName: storageClass,
+	}
+}
+
+// TestBuildWorkspace tests if the workspace of the CustomRuntimeEnvironment overrides the one of the operator,
+// which overrides our defaults
+func TestBuildWorkspace(t *testing.T) {
+	testCases := map[string]struct {
+		operator       meteorv1alpha1.WorkspaceSpec
+		cre            *meteorv1alpha1.WorkspaceSpec
+		expectedOutput meteorv1alpha1.WorkspaceSpec
+	}{
+		"defaults": {
+			expectedOutput: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", nil)},
+		},
+		"operator-storage-class": {
+			operator:       meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: v1.PersistentVolumeClaimSpec{StorageClassName: pointer.String("fast")}},
+			expectedOutput: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", pointer.String("fast"))},
+		},
+		"cre-size": {
+			operator: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: v1.PersistentVolumeClaimSpec{StorageClassName: pointer.String("fast")}},
+			cre: &meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("5Gi")}},
+			}},
+			expectedOutput: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "5Gi", pointer.String("fast"))},
+		},
+		"operator-claim": {
+			operator: meteorv1alpha1.WorkspaceSpec{ClaimName: "cre-builds"},
+			expectedOutput: meteorv1alpha1.WorkspaceSpec{
+				VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", nil),
+				ClaimName:           "cre-builds",
+			},
+		},
+		"cre-template-over-operator-claim": {
+			operator: meteorv1alpha1.WorkspaceSpec{ClaimName: "cre-builds"},
+			cre: &meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			}},
+			expectedOutput: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteMany, "500Mi", nil)},
+		},
+	}
+
+	for tcName, tc := range testCases {
+		r := &CustomRuntimeEnvironmentReconciler{Workspace: tc.operator}
+		cre := &meteorv1alpha1.CustomRuntimeEnvironment{
+			Spec: meteorv1alpha1.CustomRuntimeEnvironmentSpec{Workspace: tc.cre},
+		}
+
+		if output := r.buildWorkspace(cre); !reflect.DeepEqual(output, tc.expectedOutput) {
+			t.Errorf("%s Got %v while expecting %v", tcName, output, tc.expectedOutput)
+		}
+	}
+}
+
+// TestTektonWorkspaces tests if the builds share an existing claim by their own sub path, or get a claim of their own,
+// and get the git and image pull secrets only if they have them
+func TestTektonWorkspaces(t *testing.T) {
+	testCases := map[string]struct {
+		build                BuildRequest
+		expectedClaim        string
+		expectedSubPath      string
+		expectedTemplate     bool
+		expectedCAConfigMap  string
+		expectedCAKey        string
+		expectedCAIsOptional bool
+		expectedGitSecret    string
+		expectedPullSecret   string
+	}{
+		"defaults": {
+			build: BuildRequest{
+				Name:      "cre-test-1-package-list",
+				Workspace: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", nil)},
+			},
+			expectedTemplate:     true,
+			expectedCAConfigMap:  defaultCABundleConfigMap,
+			expectedCAKey:        defaultCABundleKey,
+			expectedCAIsOptional: true,
+		},
+		"existing-claim-and-ca-bundle": {
+			build: BuildRequest{
+				Name:      "cre-test-1-package-list",
+				Workspace: meteorv1alpha1.WorkspaceSpec{ClaimName: "cre-builds"},
+				CABundle:  &meteorv1alpha1.ConfigMapKeyReference{Name: "trusted-ca", Key: "ca-bundle.crt"},
+			},
+			expectedClaim:        "cre-builds",
+			expectedSubPath:      "cre-test-1-package-list",
+			expectedCAConfigMap:  "trusted-ca",
+			expectedCAKey:        "ca-bundle.crt",
+			expectedCAIsOptional: false,
+		},
+		"git-secret": {
+			build: BuildRequest{
+				Name:      "cre-test-1-gitrepo",
+				Workspace: meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", nil)},
+				GitSecret: "elyra-aidevsecops-tutorial-git",
+			},
+			expectedTemplate:     true,
+			expectedCAConfigMap:  defaultCABundleConfigMap,
+			expectedCAKey:        defaultCABundleKey,
+			expectedCAIsOptional: true,
+			expectedGitSecret:    "elyra-aidevsecops-tutorial-git",
+		},
+		"image-pull-secret": {
+			build: BuildRequest{
+				Name:            "cre-test-1-import",
+				Workspace:       meteorv1alpha1.WorkspaceSpec{VolumeClaimTemplate: claimTemplate(v1.ReadWriteOnce, "500Mi", nil)},
+				ImagePullSecret: "thoth-station-pull-secret",
+			},
+			expectedTemplate:     true,
+			expectedCAConfigMap:  defaultCABundleConfigMap,
+			expectedCAKey:        defaultCABundleKey,
+			expectedCAIsOptional: true,
+			expectedPullSecret:   "thoth-station-pull-secret",
+		},
+	}
+
+	for tcName, tc := range testCases {
+		workspaces := tektonWorkspaces(&tc.build)
+		data, sslcertdir := workspaces[0], workspaces[1]
+
+		claim := ""
+		if data.PersistentVolumeClaim != nil {
+			claim = data.PersistentVolumeClaim.ClaimName
+		}
+		if claim != tc.expectedClaim || data.SubPath != tc.expectedSubPath || (data.VolumeClaimTemplate != nil) != tc.expectedTemplate {
+			t.Errorf("%s Got data workspace %v", tcName, data)
+		}
+		if data.VolumeClaimTemplate != nil && data.VolumeClaimTemplate.Labels[buildLabelKey] != tc.build.Name {
+			t.Errorf("%s Got workspace labels %v while expecting build %s", tcName, data.VolumeClaimTemplate.Labels, tc.build.Name)
+		}
+
+		ca := sslcertdir.ConfigMap
+		if ca.Name != tc.expectedCAConfigMap || ca.Items[0].Key != tc.expectedCAKey || ca.Items[0].Path != "ca.crt" || *ca.Optional != tc.expectedCAIsOptional {
+			t.Errorf("%s Got sslcertdir workspace %v", tcName, ca)
+		}
+
+		gitSecret, pullSecret := "", ""
+		for _, workspace := range workspaces[2:] {
+			switch workspace.Name {
+			case "git-credentials":
+				gitSecret = workspace.Secret.SecretName
+			case "registry-credentials":
+				pullSecret = workspace.Secret.SecretName
+				if workspace.Secret.Items[0].Path != "config.json" {
+					t.Errorf("%s Got registry-credentials workspace %v", tcName, workspace.Secret)
+				}
+			}
+		}
+		if gitSecret != tc.expectedGitSecret {
+			t.Errorf("%s Got git-credentials workspace of secret %s while expecting %s", tcName, gitSecret, tc.expectedGitSecret)
+		}
+		if pullSecret != tc.expectedPullSecret {
+			t.Errorf("%s Got registry-credentials workspace of secret %s while expecting %s", tcName, pullSecret, tc.expectedPullSecret)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	//+kubebuilder:scaffold:imports
 
+	imagev1 "github.com/openshift/api/image/v1"
 	routev1 "github.com/openshift/api/route/v1"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
@@ -50,6 +51,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(meteorv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(pipelinev1beta1.AddToScheme(scheme))
+	utilruntime.Must(imagev1.AddToScheme(scheme))
 	if ctrlConfig.Spec.EnableShower {
 		utilruntime.Must(routev1.AddToScheme(scheme))
 	}
@@ -117,9 +119,24 @@ func main() {
 		}
 	}
 
+	buildBackends, err := cre.NewBuildBackends(mgr, ctrlConfig.Spec.CustomRuntimeEnvironment)
+	if err != nil {
+		setupLog.Error(err, "unable to set up build backends")
+		os.Exit(1)
+	}
+
 	if err = (&cre.CustomRuntimeEnvironmentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		APIReader:           mgr.GetAPIReader(),
+		Backends:            buildBackends,
+		DefaultBuildBackend: ctrlConfig.Spec.CustomRuntimeEnvironment.BuildBackend,
+		Pipelines:           ctrlConfig.Spec.CustomRuntimeEnvironment.Pipelines,
+		Workspace:           ctrlConfig.Spec.CustomRuntimeEnvironment.Workspace,
+		CABundle:            ctrlConfig.Spec.CustomRuntimeEnvironment.CABundle,
+		BuildTimeout:        ctrlConfig.Spec.CustomRuntimeEnvironment.BuildTimeout,
+		BuildPendingTimeout: ctrlConfig.Spec.CustomRuntimeEnvironment.BuildPendingTimeout,
+		Concurrency:         ctrlConfig.Spec.CustomRuntimeEnvironment.Concurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CustomRuntimeEnvironment")
 		os.Exit(1)
@@ -131,7 +148,7 @@ func main() {
 	   We'll just make sure to set `ENABLE_WEBHOOKS=false` when we run locally.
 	*/
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&meteorv1alpha1.CustomRuntimeEnvironment{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = (&meteorv1alpha1.CustomRuntimeEnvironment{}).SetupWebhookWithManager(mgr, ctrlConfig.Spec.CustomRuntimeEnvironment); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "CustomRuntimeEnvironment")
 			os.Exit(1)
 		}